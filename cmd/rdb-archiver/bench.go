@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/config"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+)
+
+// benchLevels are the levels tried when --levels is not given.
+var benchLevels = map[string][]int{
+	"zstd": {1, 3, 6, 10}, // the four encoder speeds
+	"gzip": {1, 6, 9},
+	"lz4":  {1, 5, 9},
+	"xz":   {0},
+	"none": {0},
+}
+
+// runBench implements "rdb-archiver bench": it compresses a file once per level
+// with the encoder settings the archiver would use and reports throughput and ratio.
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	configFile := flags.String("config", defaultConfigFile, "config file (for fs.zstd settings)")
+	file := flags.String("file", "", "file to compress, e.g. a dump.rdb")
+	codecName := flags.String("codec", fs.DefaultCodec, "codec: "+strings.Join(fs.CodecNames(), ", "))
+	levelList := flags.String("levels", "", "comma separated levels (default depends on the codec)")
+	limitMB := flags.Int64("limitMB", 0, "only compress the first N MiB of the file (0: all)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "bench: --file is required")
+		return 2
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	cfg.ApplyDefaults()
+
+	codec, err := fs.CodecByName(*codecName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+		return 2
+	}
+	levels := benchLevels[codec.Name()]
+	if *levelList != "" {
+		levels = nil
+		for _, s := range strings.Split(*levelList, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "bench: invalid level %q\n", s)
+				return 2
+			}
+			levels = append(levels, n)
+		}
+	}
+
+	lim := fs.DetectLimits()
+	fmt.Printf("file=%s cgroupCPUs=%s cgroupMemory=%s\n", *file, formatCPUs(lim.CPUs), formatBytes(lim.Memory))
+
+	// Rows are printed as they finish; large files take a while per level.
+	const row = "%-6s %5s %11s %9s %9s %14s %14s %6s %10s %8s\n"
+	fmt.Printf(row, "CODEC", "LEVEL", "CONCURRENCY", "WINDOW", "BUDGET", "IN", "OUT", "RATIO", "TIME", "MB/S")
+	for _, level := range levels {
+		opts := cfg.FS.Zstd.EncoderOptions(level)
+		in, out, took, err := benchOnce(*file, *limitMB<<20, codec, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: level %d: %v\n", level, err)
+			return 1
+		}
+		conc, window, budget := "-", "-", "-"
+		if codec.Name() == "zstd" {
+			conc, window, budget = strconv.Itoa(opts.Concurrency), formatBytes(int64(opts.WindowSize)), formatBytes(opts.Budget)
+		}
+		ratio := 0.0
+		if out > 0 {
+			ratio = float64(in) / float64(out)
+		}
+		mbps := float64(in) / (1 << 20) / took.Seconds()
+		fmt.Printf(row, codec.Name(), strconv.Itoa(level), conc, window, budget,
+			strconv.FormatInt(in, 10), strconv.FormatInt(out, 10), fmt.Sprintf("%.2f", ratio),
+			took.Round(time.Millisecond).String(), fmt.Sprintf("%.1f", mbps))
+	}
+	return 0
+}
+
+// benchOnce compresses the first limit bytes of path (all if 0) into a counter.
+func benchOnce(path string, limit int64, codec fs.Codec, opts fs.EncoderOptions) (in, out int64, took time.Duration, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer f.Close()
+
+	var src io.Reader = f
+	if limit > 0 {
+		src = io.LimitReader(f, limit)
+	}
+
+	var cnt countingWriter
+	start := time.Now()
+	enc, err := codec.NewWriter(&cnt, opts)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if in, err = io.Copy(enc, src); err != nil {
+		_ = enc.Close()
+		return 0, 0, 0, err
+	}
+	if err := enc.Close(); err != nil {
+		return 0, 0, 0, err
+	}
+	return in, cnt.n, time.Since(start), nil
+}
+
+type countingWriter struct{ n int64 }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+func formatCPUs(n float64) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n <= 0:
+		return "unlimited"
+	case n%(1<<30) == 0:
+		return fmt.Sprintf("%dGiB", n>>30)
+	case n%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", n>>20)
+	default:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	}
+}
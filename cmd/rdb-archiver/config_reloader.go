@@ -3,6 +3,7 @@
 import (
 	"context"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/raoulx24/rdb-archiver/internal/config"
@@ -19,6 +20,8 @@ type ConfigReloader struct {
 	cancel   context.CancelFunc
 	timer    *time.Timer
 	reloadCh chan struct{}
+	extra    []string
+	extraFn  func(cfg *config.Config) []string
 }
 
 func NewConfigReloader(
@@ -38,6 +41,13 @@ func NewConfigReloader(
 	}
 }
 
+// WatchExtra makes changes to other files referenced by the config, such as
+// key files, trigger a reload too. files is re-evaluated after each reload.
+func (r *ConfigReloader) WatchExtra(cfg *config.Config, files func(cfg *config.Config) []string) {
+	r.extraFn = files
+	r.extra = files(cfg)
+}
+
 func (r *ConfigReloader) Start(ctx context.Context) {
 	r.startWatcher(ctx)
 
@@ -63,14 +73,16 @@ func (r *ConfigReloader) startWatcher(ctx context.Context) {
 	var wctx context.Context
 	wctx, r.cancel = context.WithCancel(ctx)
 
-	dir := filepath.Dir(r.file)
-	base := filepath.Base(r.file)
+	for _, file := range append([]string{r.file}, r.extra...) {
+		dir := filepath.Dir(file)
+		base := filepath.Base(file)
 
-	go func() {
-		if err := r.fw.StartWatchingForFile(wctx, r.method, dir, base, r.reloadCh); err != nil {
-			r.logg.Error("config watcher failed", "error", err)
-		}
-	}()
+		go func() {
+			if err := r.fw.StartWatchingForFile(wctx, r.method, dir, base, r.reloadCh); err != nil {
+				r.logg.Error("config watcher failed", "file", file, "error", err)
+			}
+		}()
+	}
 }
 
 func (r *ConfigReloader) scheduleReload(ctx context.Context) {
@@ -88,8 +100,13 @@ func (r *ConfigReloader) scheduleReload(ctx context.Context) {
 
 		r.apply(newCfg)
 
-		if newCfg.ConfigReload.Method != r.method {
+		var extra []string
+		if r.extraFn != nil {
+			extra = r.extraFn(newCfg)
+		}
+		if newCfg.ConfigReload.Method != r.method || !slices.Equal(extra, r.extra) {
 			r.method = newCfg.ConfigReload.Method
+			r.extra = extra
 			r.startWatcher(ctx)
 		}
 
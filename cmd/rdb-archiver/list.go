@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/raoulx24/rdb-archiver/internal/catalog"
+	"github.com/raoulx24/rdb-archiver/internal/cluster"
+	"github.com/raoulx24/rdb-archiver/internal/config"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+)
+
+// runList implements "rdb-archiver list": it prints the archived snapshots of
+// a target with what their manifests say about them.
+func runList(args []string) int {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	configFile := flags.String("config", defaultConfigFile, "config file")
+	rule := flags.String("rule", "", "only list this rule folder (default: all)")
+	targetName := flags.String("target", "", "destination target to read from (default: the first one)")
+	asJSON := flags.Bool("json", false, "print full entries, manifests included, as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	cfg.ApplyDefaults()
+	logg := logging.NewSlogLogger(cfg.Logging)
+
+	tc, err := findTarget(cfg.Destination, *targetName)
+	if err != nil {
+		logg.Error("list failed", "error", err)
+		return 1
+	}
+
+	src, err := fs.Open(tc.Backend, tc.S3, fs.New(cfg.FS))
+	if err != nil {
+		logg.Error("invalid destination", "target", tc.Name, "error", err)
+		return 1
+	}
+
+	var rules []string
+	if *rule != "" {
+		rules = append(rules, *rule)
+	}
+	entries, err := catalog.List(context.Background(), src, filepath.Join(tc.Root, tc.SubDir), rules...)
+	if err != nil {
+		logg.Error("list failed", "error", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			logg.Error("list failed", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tSNAPSHOT\tSIZE\tREDIS\tKEYS\tROLE\tNODE\tSLOTS")
+	for _, e := range entries {
+		redis, keys, role, node, slots := "-", "-", "-", "-", "-"
+		if m := e.Manifest; m != nil {
+			if m.RDB != nil {
+				redis = m.RDB.RedisVersion
+				keys = strconv.FormatUint(m.RDB.KeyCount(), 10)
+			}
+			if m.Cluster != nil && m.Cluster.Myself != nil {
+				me := m.Cluster.Myself
+				role, node, slots = me.Role, me.ID, formatSlots(me.Slots)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", e.Rule, e.Snapshot, e.Size, redis, keys, role, node, slots)
+	}
+	_ = tw.Flush()
+	return 0
+}
+
+func formatSlots(ranges []cluster.SlotRange) string {
+	if len(ranges) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Start == r.End {
+			parts = append(parts, strconv.Itoa(r.Start))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.Start, r.End))
+		}
+	}
+	return strings.Join(parts, ",")
+}
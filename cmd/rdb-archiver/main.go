@@ -12,7 +12,7 @@ import (
 	"github.com/raoulx24/rdb-archiver/internal/health"
 	"github.com/raoulx24/rdb-archiver/internal/logging"
 	"github.com/raoulx24/rdb-archiver/internal/mailbox"
-	"github.com/raoulx24/rdb-archiver/internal/retention"
+	"github.com/raoulx24/rdb-archiver/internal/scrub"
 	"github.com/raoulx24/rdb-archiver/internal/snapshot"
 	"github.com/raoulx24/rdb-archiver/internal/snapshotwatcher"
 	"github.com/raoulx24/rdb-archiver/internal/watchfs"
@@ -26,11 +26,26 @@ var (
 )
 
 
+const defaultConfigFile = "config/config.yaml"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			os.Exit(runRestore(os.Args[2:]))
+		case "list":
+			os.Exit(runList(os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	configFile := "config/config.yaml"
+	configFile := defaultConfigFile
 	stdLog := log.New(os.Stdout, "", log.LstdFlags)
 
 	cfg, err := config.Load(configFile)
@@ -50,8 +65,9 @@ func main() {
 	}()
 
 	osfs := fs.New(cfg.FS)
+	enc := cfg.FS.Zstd.EncoderOptions(cfg.FS.CompressionLevel)
+	logg.Info("zstd encoder", "concurrency", enc.Concurrency, "windowSize", enc.WindowSize, "memoryBudget", enc.Budget)
 	mb := mailbox.New[snapshot.Job]()
-	ret := retention.New(logg)
 
 	fw, err := watchfs.New(cfg.WatchFS, logg)
 	if err != nil {
@@ -59,8 +75,20 @@ func main() {
 		os.Exit(1)
 	}
 
-	mainWorker := worker.New(cfg.Destination, logg, ret, mb, osfs)
-	go mainWorker.Start(ctx)
+	mainWorker, err := worker.New(cfg.Destination, logg, mb, osfs)
+	if err != nil {
+		logg.Error("invalid destination", "error", err)
+		os.Exit(1)
+	}
+	// The worker removes its partial archives when cancelled; wait for it on exit.
+	workerDone := make(chan struct{})
+	go func() {
+		mainWorker.Start(ctx)
+		close(workerDone)
+	}()
+
+	scrubber := scrub.New(cfg.Scrub, cfg.Destination, osfs, logg)
+	go scrubber.Start(ctx)
 
 	snapWatcher := snapshotwatcher.New(cfg.Source, fw, mb, logg)
 	swm := NewSnapshotWatcherManager(snapWatcher, logg)
@@ -77,6 +105,7 @@ func main() {
 				fw.UpdateConfig(newCfg.WatchFS)
 				osfs.UpdateConfig(newCfg.FS)
 				mainWorker.UpdateConfig(newCfg.Destination)
+				scrubber.UpdateConfig(newCfg.Scrub, newCfg.Destination)
 
 				oldSnapCfg := snapWatcher.CurrentConfig()
 				snapWatcher.UpdateConfig(newCfg.Source)
@@ -85,10 +114,11 @@ func main() {
 				}
 			},
 		)
+		reloader.WatchExtra(cfg, func(c *config.Config) []string { return c.Destination.KeyFiles() })
 		go reloader.Start(ctx)
 	}
 
-	healthSrv := health.New(cfg.Health, snapWatcher)
+	healthSrv := health.New(cfg.Health, snapWatcher, mainWorker, scrubber)
 	go func() {
 		if err := healthSrv.Start(ctx); err != nil {
 			logg.Error("health server stopped", "error", err)
@@ -96,5 +126,6 @@ func main() {
 	}()
 
 	<-ctx.Done()
+	<-workerDone
 	stdLog.Println("exit complete")
 }
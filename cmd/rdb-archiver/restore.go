@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/raoulx24/rdb-archiver/internal/config"
+	"github.com/raoulx24/rdb-archiver/internal/crypt"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+	"github.com/raoulx24/rdb-archiver/internal/restore"
+	"github.com/raoulx24/rdb-archiver/internal/worker"
+)
+
+// runRestore implements "rdb-archiver restore": it extracts an archived snapshot
+// back into the Redis data dir.
+func runRestore(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	configFile := flags.String("config", defaultConfigFile, "config file")
+	rule := flags.String("rule", "", "rule folder to restore from (default: the snapshot folder)")
+	at := flags.String("at", "", "snapshot timestamp, e.g. 2025-02-24T23-59-00")
+	latest := flags.Bool("latest", false, "restore the newest snapshot of the rule")
+	targetName := flags.String("target", "", "destination target to read from (default: the first one)")
+	dir := flags.String("dir", "", "directory to restore into (default: source.path)")
+	stopped := flags.Bool("redis-stopped", false, "confirm that no Redis server uses the target dir")
+	force := flags.Bool("force", false, "restore without --redis-stopped, even if the target files look in use")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if (*at == "") == !*latest {
+		fmt.Fprintln(os.Stderr, "restore: exactly one of --at or --latest is required")
+		return 2
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	cfg.ApplyDefaults()
+	logg := logging.NewSlogLogger(cfg.Logging)
+
+	tc, err := findTarget(cfg.Destination, *targetName)
+	if err != nil {
+		logg.Error("restore failed", "error", err)
+		return 1
+	}
+
+	osfs := fs.New(cfg.FS)
+	src, err := fs.Open(tc.Backend, tc.S3, osfs)
+	if err != nil {
+		logg.Error("invalid destination", "target", tc.Name, "error", err)
+		return 1
+	}
+
+	keys, err := crypt.LoadKeys(tc.Encryption)
+	if err != nil {
+		logg.Error("loading decryption keys failed", "target", tc.Name, "error", err)
+		return 1
+	}
+
+	opts := restore.Options{
+		Rule:         *rule,
+		At:           *at,
+		Latest:       *latest,
+		Dir:          *dir,
+		RedisStopped: *stopped,
+		Force:        *force,
+	}
+	if opts.Rule == "" {
+		opts.Rule = tc.SnapshotSubdir
+	}
+	if opts.Dir == "" {
+		opts.Dir = cfg.Source.Path
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	root := filepath.Join(tc.Root, tc.SubDir)
+	if err := restore.New(src, osfs, keys, logg).Run(ctx, root, opts); err != nil {
+		logg.Error("restore failed", "error", err)
+		return 1
+	}
+	logg.Info("restore complete")
+	return 0
+}
+
+// findTarget returns the named destination target, or the first one.
+func findTarget(dest worker.Config, name string) (worker.TargetConfig, error) {
+	targets := dest.TargetConfigs()
+	if name == "" {
+		return targets[0], nil
+	}
+	for _, t := range targets {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return worker.TargetConfig{}, fmt.Errorf("unknown destination target %q", name)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/raoulx24/rdb-archiver/internal/catalog"
+	"github.com/raoulx24/rdb-archiver/internal/config"
+	"github.com/raoulx24/rdb-archiver/internal/crypt"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+	"github.com/raoulx24/rdb-archiver/internal/verify"
+)
+
+// runVerify implements "rdb-archiver verify": it re-checks archives against
+// the checksums and signature of their manifest sidecars.
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	configFile := flags.String("config", defaultConfigFile, "config file")
+	rule := flags.String("rule", "", "rule folder to verify (default: all, or the snapshot folder with --at/--latest)")
+	at := flags.String("at", "", "only verify this snapshot timestamp, e.g. 2025-02-24T23-59-00")
+	latest := flags.Bool("latest", false, "only verify the newest snapshot of the rule")
+	targetName := flags.String("target", "", "destination target to read from (default: the first one)")
+	pubKey := flags.String("pubkey", "", "ed25519 public key for signatures (default: destination.signing)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *at != "" && *latest {
+		fmt.Fprintln(os.Stderr, "verify: --at and --latest are exclusive")
+		return 2
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	cfg.ApplyDefaults()
+	logg := logging.NewSlogLogger(cfg.Logging)
+
+	tc, err := findTarget(cfg.Destination, *targetName)
+	if err != nil {
+		logg.Error("verify failed", "error", err)
+		return 1
+	}
+
+	src, err := fs.Open(tc.Backend, tc.S3, fs.New(cfg.FS))
+	if err != nil {
+		logg.Error("invalid destination", "target", tc.Name, "error", err)
+		return 1
+	}
+
+	keys, err := crypt.LoadKeys(tc.Encryption)
+	if err != nil {
+		logg.Error("loading decryption keys failed", "target", tc.Name, "error", err)
+		return 1
+	}
+
+	var pub ed25519.PublicKey
+	if *pubKey == "" {
+		*pubKey = cfg.Destination.Signing.VerifyKeyFile()
+	}
+	if *pubKey != "" {
+		if pub, err = manifest.LoadPublicKey(*pubKey); err != nil {
+			logg.Error("loading public key failed", "error", err)
+			return 1
+		}
+	}
+
+	var rules []string
+	switch {
+	case *rule != "":
+		rules = append(rules, *rule)
+	case *at != "" || *latest:
+		rules = append(rules, tc.SnapshotSubdir)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	entries, err := catalog.List(ctx, src, filepath.Join(tc.Root, tc.SubDir), rules...)
+	if err != nil {
+		logg.Error("verify failed", "error", err)
+		return 1
+	}
+	entries = selectEntries(entries, *at, *latest)
+	if len(entries) == 0 {
+		logg.Error("verify failed", "error", errors.New("no matching snapshots"))
+		return 1
+	}
+
+	v := verify.New(src, keys, pub)
+	failed := 0
+	for _, e := range entries {
+		res, err := v.Verify(ctx, e.Path)
+		if ctx.Err() != nil {
+			logg.Error("verify interrupted")
+			return 1
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s/%s: %v\n", e.Rule, filepath.Base(e.Path), err)
+			continue
+		}
+		fmt.Printf("OK    %s/%s: %s\n", e.Rule, filepath.Base(e.Path), describe(res))
+	}
+
+	if failed > 0 {
+		logg.Error("verify failed", "archives", len(entries), "failed", failed)
+		return 1
+	}
+	return 0
+}
+
+// selectEntries applies --at and --latest to entries, newest first per rule.
+func selectEntries(entries []catalog.Entry, at string, latest bool) []catalog.Entry {
+	if at == "" && !latest {
+		return entries
+	}
+	var out []catalog.Entry
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if (at != "" && e.Snapshot != at) || seen[e.Rule] {
+			continue
+		}
+		if latest {
+			seen[e.Rule] = true
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func describe(res verify.Result) string {
+	var parts []string
+	switch {
+	case res.Manifest && res.Decoded:
+		parts = append(parts, fmt.Sprintf("checksums match, %d members", res.Members))
+	case res.Manifest:
+		parts = append(parts, "archive checksum matches")
+	default:
+		parts = append(parts, fmt.Sprintf("decoded, %d members", res.Members))
+	}
+	if res.RDBs > 0 {
+		parts = append(parts, fmt.Sprintf("%d rdb valid", res.RDBs))
+	}
+	if res.SignedBy != "" {
+		parts = append(parts, "signed by "+res.SignedBy)
+	}
+	parts = append(parts, res.Notes...)
+	return strings.Join(parts, "; ")
+}
@@ -5,9 +5,17 @@ go 1.25.0
 require github.com/robfig/cron/v3 v3.0.1
 
 require (
+	filippo.io/age v1.3.2
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/klauspost/compress v1.18.4
+	github.com/pierrec/lz4/v4 v4.1.31
+	github.com/ulikunitz/xz v0.5.15
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/sys v0.13.0 // indirect
+require golang.org/x/sys v0.47.0
+
+require (
+	filippo.io/hpke v0.4.0 // indirect
+	golang.org/x/crypto v0.55.0 // indirect
+)
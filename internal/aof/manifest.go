@@ -0,0 +1,177 @@
+// Package aof reads the manifest of a Redis 7+ multi-part AOF directory.
+package aof
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// File types listed in the manifest.
+const (
+	TypeBase    = "b"
+	TypeHistory = "h" // superseded by a rewrite, about to be deleted
+	TypeIncr    = "i"
+)
+
+// ManifestSuffix ends the manifest name: <appendfilename>.manifest.
+const ManifestSuffix = ".manifest"
+
+// File is one manifest entry.
+type File struct {
+	Name string `json:"name"`
+	Seq  int64  `json:"seq"`
+	Type string `json:"type"`
+}
+
+// Manifest is the parsed content of an AOF manifest.
+type Manifest struct {
+	Files []File `json:"files"`
+}
+
+// Live returns the files Redis loads: the base and the incr files, in load order.
+func (m *Manifest) Live() []File {
+	var out []File
+	for _, f := range m.Files {
+		if f.Type == TypeBase {
+			out = append(out, f)
+		}
+	}
+	for _, f := range m.Files {
+		if f.Type == TypeIncr {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Active returns the incr file currently appended to, if any.
+func (m *Manifest) Active() (File, bool) {
+	var last File
+	found := false
+	for _, f := range m.Files {
+		if f.Type == TypeIncr && (!found || f.Seq > last.Seq) {
+			last, found = f, true
+		}
+	}
+	return last, found
+}
+
+// ParseManifestFile parses the manifest at path. See ParseManifest.
+func ParseManifestFile(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseManifest(f)
+}
+
+// ParseManifest parses lines of "file <name> seq <n> type <b|h|i>" pairs.
+// Unknown keys are ignored, as Redis does for forward compatibility.
+func ParseManifest(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	sc := bufio.NewScanner(r)
+
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		args, err := splitArgs(text)
+		if err != nil {
+			return nil, fmt.Errorf("aof manifest line %d: %w", line, err)
+		}
+		if len(args)%2 != 0 {
+			return nil, fmt.Errorf("aof manifest line %d: odd number of fields", line)
+		}
+
+		var f File
+		for i := 0; i < len(args); i += 2 {
+			switch args[i] {
+			case "file":
+				f.Name = args[i+1]
+			case "seq":
+				if f.Seq, err = strconv.ParseInt(args[i+1], 10, 64); err != nil {
+					return nil, fmt.Errorf("aof manifest line %d: seq: %w", line, err)
+				}
+			case "type":
+				f.Type = args[i+1]
+			}
+		}
+		if f.Name == "" || strings.ContainsAny(f.Name, `/\`) {
+			return nil, fmt.Errorf("aof manifest line %d: bad file name %q", line, f.Name)
+		}
+		switch f.Type {
+		case TypeBase, TypeHistory, TypeIncr:
+		default:
+			return nil, fmt.Errorf("aof manifest line %d: unknown type %q", line, f.Type)
+		}
+		m.Files = append(m.Files, f)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.Live()) == 0 {
+		return nil, fmt.Errorf("aof manifest lists no base or incr file")
+	}
+	return m, nil
+}
+
+// splitArgs splits a line into fields; names with spaces are written quoted.
+func splitArgs(s string) ([]string, error) {
+	var (
+		out []string
+		cur strings.Builder
+	)
+	for i := 0; i < len(s); {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i == len(s) {
+			break
+		}
+		cur.Reset()
+		if s[i] != '"' {
+			for i < len(s) && s[i] != ' ' {
+				cur.WriteByte(s[i])
+				i++
+			}
+			out = append(out, cur.String())
+			continue
+		}
+
+		i++ // opening quote
+		closed := false
+		for i < len(s) {
+			c := s[i]
+			i++
+			if c == '"' {
+				closed = true
+				break
+			}
+			if c == '\\' && i < len(s) {
+				c = s[i]
+				i++
+				switch c {
+				case 'n':
+					c = '\n'
+				case 't':
+					c = '\t'
+				}
+			}
+			cur.WriteByte(c)
+		}
+		if !closed {
+			return nil, fmt.Errorf("unterminated quote")
+		}
+		out = append(out, cur.String())
+	}
+	return out, nil
+}
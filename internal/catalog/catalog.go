@@ -0,0 +1,114 @@
+// Package catalog lists archived snapshots together with their manifests.
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+)
+
+// Entry is one archive found in a rule folder.
+type Entry struct {
+	Rule     string             `json:"rule"`
+	Snapshot string             `json:"snapshot"` // archive name without extension
+	Path     string             `json:"path"`
+	Codec    string             `json:"codec"`
+	Sealed   bool               `json:"sealed"` // encrypted; see crypt.Header
+	Size     int64              `json:"size"`
+	ModTime  time.Time          `json:"modTime"`
+	Manifest *manifest.Manifest `json:"manifest,omitempty"` // nil for archives without a sidecar
+}
+
+// List returns the archives below root, newest first. With rules empty every
+// folder below root is listed.
+func List(ctx context.Context, filesystem fs.FS, root string, rules ...string) ([]Entry, error) {
+	if len(rules) == 0 {
+		entries, err := filesystem.ReadDir(ctx, root)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", root, err)
+		}
+		for _, ent := range entries {
+			if ent.IsDir() {
+				rules = append(rules, ent.Name())
+			}
+		}
+	}
+
+	var out []Entry
+	for _, rule := range rules {
+		found, err := listRule(ctx, filesystem, root, rule)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, found...)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Snapshot != out[j].Snapshot {
+			return out[i].Snapshot > out[j].Snapshot
+		}
+		return out[i].Rule < out[j].Rule
+	})
+	return out, nil
+}
+
+func listRule(ctx context.Context, filesystem fs.FS, root, rule string) ([]Entry, error) {
+	dir := filepath.Join(root, rule)
+	entries, err := filesystem.ReadDir(ctx, dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dir, err)
+	}
+
+	var out []Entry
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		codec, ok := fs.CodecForPath(name)
+		if !ok {
+			continue
+		}
+
+		e := Entry{
+			Rule:     rule,
+			Snapshot: strings.TrimSuffix(name, codec.Ext()),
+			Path:     filepath.Join(dir, name),
+			Codec:    codec.Name(),
+			Sealed:   fs.IsSealed(name),
+		}
+		if info, err := ent.Info(); err == nil {
+			e.Size, e.ModTime = info.Size(), info.ModTime()
+		}
+		e.Manifest, _ = ReadSidecar(ctx, filesystem, e.Path)
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// ReadSidecar loads the manifest stored next to an archive.
+func ReadSidecar(ctx context.Context, filesystem fs.FS, archive string) (*manifest.Manifest, error) {
+	in, err := filesystem.Open(ctx, manifest.SidecarPath(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Parse(data)
+}
@@ -0,0 +1,221 @@
+// Package cluster reads Redis Cluster state files.
+package cluster
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Roles reported for a node.
+const (
+	RoleMaster  = "master"
+	RoleReplica = "replica"
+)
+
+// SlotRange is an inclusive range of hash slots.
+type SlotRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Node is one line of nodes.conf.
+type Node struct {
+	ID          string      `json:"id"`
+	Addr        string      `json:"addr"` // ip:port@cport
+	Hostname    string      `json:"hostname,omitempty"`
+	Flags       []string    `json:"flags"`
+	Role        string      `json:"role"`
+	MasterID    string      `json:"masterId,omitempty"`
+	ConfigEpoch uint64      `json:"configEpoch"`
+	LinkState   string      `json:"linkState"`
+	Slots       []SlotRange `json:"slots,omitempty"`
+	Migrating   []string    `json:"migrating,omitempty"` // "slot->node" as written by the server
+	Importing   []string    `json:"importing,omitempty"` // "slot-<node" as written by the server
+}
+
+// Topology is the cluster view of the node that wrote nodes.conf.
+type Topology struct {
+	Myself        *Node  `json:"myself,omitempty"`
+	CurrentEpoch  uint64 `json:"currentEpoch"`
+	LastVoteEpoch uint64 `json:"lastVoteEpoch"`
+	Nodes         []Node `json:"nodes"`
+}
+
+// IsNodesFile reports whether an aux file name looks like a cluster config file
+// (cluster-config-file defaults to nodes.conf, often nodes-<port>.conf).
+func IsNodesFile(name string) bool {
+	ok, _ := filepath.Match("nodes*.conf", filepath.Base(name))
+	return ok
+}
+
+// ParseNodesFile parses the nodes.conf at path. See ParseNodes.
+func ParseNodesFile(path string) (*Topology, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseNodes(f)
+}
+
+// ParseNodes parses a nodes.conf stream.
+func ParseNodes(r io.Reader) (*Topology, error) {
+	topo := &Topology{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 4<<20) // a node owning scattered slots makes long lines
+
+	line := 0
+	for sc.Scan() {
+		line++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "vars" {
+			if err := topo.parseVars(fields[1:]); err != nil {
+				return nil, fmt.Errorf("nodes.conf line %d: %w", line, err)
+			}
+			continue
+		}
+
+		n, err := parseNode(fields)
+		if err != nil {
+			return nil, fmt.Errorf("nodes.conf line %d: %w", line, err)
+		}
+		topo.Nodes = append(topo.Nodes, n)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(topo.Nodes) == 0 {
+		return nil, fmt.Errorf("nodes.conf: no nodes")
+	}
+
+	for i := range topo.Nodes {
+		if hasFlag(topo.Nodes[i].Flags, "myself") {
+			topo.Myself = &topo.Nodes[i]
+			break
+		}
+	}
+	return topo, nil
+}
+
+func (t *Topology) parseVars(kv []string) error {
+	for i := 0; i+1 < len(kv); i += 2 {
+		v, err := strconv.ParseUint(kv[i+1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("var %s: %w", kv[i], err)
+		}
+		switch kv[i] {
+		case "currentEpoch":
+			t.CurrentEpoch = v
+		case "lastVoteEpoch":
+			t.LastVoteEpoch = v
+		}
+	}
+	return nil
+}
+
+// parseNode parses "<id> <addr> <flags> <master> <ping> <pong> <epoch> <link> <slot>...".
+func parseNode(f []string) (Node, error) {
+	if len(f) < 8 {
+		return Node{}, fmt.Errorf("expected at least 8 fields, got %d", len(f))
+	}
+
+	n := Node{
+		ID:        f[0],
+		Flags:     strings.Split(f[2], ","),
+		LinkState: f[7],
+	}
+
+	// ip:port@cport[,hostname[,aux=value...]]
+	addr, rest, _ := strings.Cut(f[1], ",")
+	n.Addr = addr
+	if host, _, _ := strings.Cut(rest, ","); host != "" && !strings.Contains(host, "=") {
+		n.Hostname = host
+	}
+
+	if f[3] != "-" {
+		n.MasterID = f[3]
+	}
+
+	epoch, err := strconv.ParseUint(f[6], 10, 64)
+	if err != nil {
+		return Node{}, fmt.Errorf("config epoch: %w", err)
+	}
+	n.ConfigEpoch = epoch
+
+	switch {
+	case hasFlag(n.Flags, "master"):
+		n.Role = RoleMaster
+	case hasFlag(n.Flags, "slave"), hasFlag(n.Flags, "replica"):
+		n.Role = RoleReplica
+	}
+
+	for _, s := range f[8:] {
+		if strings.HasPrefix(s, "[") {
+			spec := strings.Trim(s, "[]")
+			if strings.Contains(spec, "->-") {
+				n.Migrating = append(n.Migrating, spec)
+			} else {
+				n.Importing = append(n.Importing, spec)
+			}
+			continue
+		}
+
+		r, err := parseSlotRange(s)
+		if err != nil {
+			return Node{}, err
+		}
+		n.Slots = append(n.Slots, r)
+	}
+	return n, nil
+}
+
+func parseSlotRange(s string) (SlotRange, error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	start, err := strconv.Atoi(lo)
+	if err != nil {
+		return SlotRange{}, fmt.Errorf("slot %q: %w", s, err)
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.Atoi(hi); err != nil {
+			return SlotRange{}, fmt.Errorf("slot %q: %w", s, err)
+		}
+	}
+	r := SlotRange{Start: start, End: end}
+	if !r.Valid() {
+		return SlotRange{}, fmt.Errorf("slot %q out of range", s)
+	}
+	return r, nil
+}
+
+// Valid reports whether r is a non-empty range within the 16384 hash slots.
+func (r SlotRange) Valid() bool {
+	return r.Start >= 0 && r.Start <= r.End && r.End <= 16383
+}
+
+// SlotCount returns how many slots the node serves.
+func (n *Node) SlotCount() int {
+	c := 0
+	for _, r := range n.Slots {
+		c += r.End - r.Start + 1
+	}
+	return c
+}
+
+func hasFlag(flags []string, f string) bool {
+	for _, x := range flags {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+// Package clusterset groups the snapshots that sibling cluster nodes archive
+// under one destination root into cluster-wide snapshot sets. A set is complete
+// when its primaries cover all hash slots.
+package clusterset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/catalog"
+	"github.com/raoulx24/rdb-archiver/internal/cluster"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+const (
+	// Slots is the number of hash slots of a Redis cluster.
+	Slots = 16384
+
+	setSuffix     = ".set.json"
+	schemaVersion = 1
+)
+
+// Set is the manifest of one cluster snapshot set.
+type Set struct {
+	Version      int                 `json:"version"`
+	ID           string              `json:"id"`     // timestamp of the oldest member
+	Anchor       string              `json:"anchor"` // snapshot the set was assembled around
+	Rule         string              `json:"rule"`
+	Tolerance    string              `json:"tolerance"`
+	CreatedAt    time.Time           `json:"createdAt"`
+	Complete     bool                `json:"complete"`
+	CurrentEpoch uint64              `json:"currentEpoch"`
+	Members      []Member            `json:"members"`
+	MissingSlots []cluster.SlotRange `json:"missingSlots,omitempty"`
+	Stale        []Stale             `json:"stale,omitempty"`
+	Invalid      []Invalid           `json:"invalid,omitempty"`
+}
+
+// Member is the snapshot of one primary included in a set.
+type Member struct {
+	Host        string              `json:"host"`
+	Snapshot    string              `json:"snapshot"`
+	Archive     string              `json:"archive"` // file name in the rule folder
+	NodeID      string              `json:"nodeId"`
+	ConfigEpoch uint64              `json:"configEpoch"`
+	Slots       []cluster.SlotRange `json:"slots"`
+}
+
+// Stale is a primary whose closest snapshot is outside the tolerance.
+type Stale struct {
+	Host     string `json:"host"`
+	NodeID   string `json:"nodeId"`
+	Snapshot string `json:"snapshot"` // closest snapshot found
+	Offset   string `json:"offset"`   // its distance from the anchor
+}
+
+// Invalid is a primary whose manifest records slots that do not exist; it is
+// left out of the set.
+type Invalid struct {
+	Host     string `json:"host"`
+	NodeID   string `json:"nodeId"`
+	Snapshot string `json:"snapshot"`
+	Slots    string `json:"slots"` // the first invalid range
+}
+
+// Path returns the archive of m below root.
+func (s *Set) Path(root string, m Member) string {
+	name := m.Archive
+	if name == "" {
+		name = m.Snapshot + ".tar.zst" // sets written before codecs were selectable
+	}
+	return filepath.Join(root, m.Host, s.Rule, name)
+}
+
+// Assemble builds the set around anchor from the primaries' snapshots found in
+// the sibling host folders of root. It returns nil when no primary snapshot is
+// within the tolerance.
+func Assemble(ctx context.Context, filesystem fs.FS, root string, cfg Config, anchor time.Time) (*Set, error) {
+	hosts, err := filesystem.ReadDir(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", root, err)
+	}
+
+	tol := cfg.tolerance()
+	set := &Set{
+		Version:   schemaVersion,
+		Anchor:    snapshot.FormatTimestamp(anchor),
+		Rule:      cfg.Rule,
+		Tolerance: cfg.Tolerance,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	var covered [Slots]bool
+	var oldest time.Time
+
+	for _, h := range hosts {
+		if !h.IsDir() || h.Name() == cfg.Dir {
+			continue
+		}
+		host := h.Name()
+
+		entries, err := catalog.List(ctx, filesystem, filepath.Join(root, host), cfg.Rule)
+		if err != nil {
+			return nil, err
+		}
+
+		best, bestAt, found := closestPrimary(entries, anchor)
+		if !found {
+			continue // not a cluster primary: replicas and standalone nodes do not own slots
+		}
+		me := best.Manifest.Cluster.Myself
+
+		// Sidecars come from every node sharing root; never trust their slots.
+		if i := slices.IndexFunc(me.Slots, func(r cluster.SlotRange) bool { return !r.Valid() }); i >= 0 {
+			r := me.Slots[i]
+			set.Invalid = append(set.Invalid, Invalid{Host: host, NodeID: me.ID, Snapshot: best.Snapshot, Slots: fmt.Sprintf("%d-%d", r.Start, r.End)})
+			continue
+		}
+
+		offset := bestAt.Sub(anchor)
+		if offset.Abs() > tol {
+			set.Stale = append(set.Stale, Stale{Host: host, NodeID: me.ID, Snapshot: best.Snapshot, Offset: offset.String()})
+			continue
+		}
+
+		set.Members = append(set.Members, Member{
+			Host:        host,
+			Snapshot:    best.Snapshot,
+			Archive:     filepath.Base(best.Path),
+			NodeID:      me.ID,
+			ConfigEpoch: me.ConfigEpoch,
+			Slots:       me.Slots,
+		})
+		set.CurrentEpoch = max(set.CurrentEpoch, best.Manifest.Cluster.CurrentEpoch)
+		if oldest.IsZero() || bestAt.Before(oldest) {
+			oldest = bestAt
+		}
+		for _, r := range me.Slots {
+			for s := r.Start; s <= r.End; s++ {
+				covered[s] = true
+			}
+		}
+	}
+
+	if len(set.Members) == 0 {
+		return nil, nil
+	}
+
+	set.ID = snapshot.FormatTimestamp(oldest)
+	set.MissingSlots = missing(covered[:])
+	set.Complete = len(set.MissingSlots) == 0
+	sort.Slice(set.Members, func(i, j int) bool { return set.Members[i].Host < set.Members[j].Host })
+	return set, nil
+}
+
+// closestPrimary returns the primary snapshot closest in time to anchor.
+func closestPrimary(entries []catalog.Entry, anchor time.Time) (catalog.Entry, time.Time, bool) {
+	var (
+		best   catalog.Entry
+		bestAt time.Time
+		found  bool
+	)
+	for _, e := range entries {
+		m := e.Manifest
+		if m == nil || m.Cluster == nil || m.Cluster.Myself == nil || m.Cluster.Myself.Role != cluster.RoleMaster {
+			continue
+		}
+		at, err := snapshot.ParseTimestamp(e.Snapshot)
+		if err != nil {
+			continue
+		}
+		if !found || at.Sub(anchor).Abs() < bestAt.Sub(anchor).Abs() {
+			best, bestAt, found = e, at, true
+		}
+	}
+	return best, bestAt, found
+}
+
+func missing(covered []bool) []cluster.SlotRange {
+	var out []cluster.SlotRange
+	for s := 0; s < len(covered); s++ {
+		if covered[s] {
+			continue
+		}
+		start := s
+		for s+1 < len(covered) && !covered[s+1] {
+			s++
+		}
+		out = append(out, cluster.SlotRange{Start: start, End: s})
+	}
+	return out
+}
+
+// MissingCount returns the number of uncovered slots.
+func (s *Set) MissingCount() int {
+	n := 0
+	for _, r := range s.MissingSlots {
+		n += r.End - r.Start + 1
+	}
+	return n
+}
+
+// Write stores the set manifest under root/cfg.Dir. Nodes assembling the same
+// members produce the same ID, so concurrent writers converge on one file.
+func Write(ctx context.Context, filesystem fs.FS, root string, cfg Config, set *Set) error {
+	dir := filepath.Join(root, cfg.Dir)
+	if err := filesystem.MkdirAll(dir); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	return filesystem.WriteFile(ctx, filepath.Join(dir, set.ID+setSuffix), data)
+}
+
+// List returns the stored sets, newest first.
+func List(ctx context.Context, filesystem fs.FS, root string, cfg Config) ([]*Set, error) {
+	dir := filepath.Join(root, cfg.Dir)
+	entries, err := filesystem.ReadDir(ctx, dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dir, err)
+	}
+
+	var out []*Set
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, setSuffix) {
+			continue
+		}
+		set, err := read(ctx, filesystem, filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading set %s: %w", name, err)
+		}
+		out = append(out, set)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+func read(ctx context.Context, filesystem fs.FS, path string) (*Set, error) {
+	in, err := filesystem.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	var set Set
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// Prune removes set manifests beyond the newest cfg.Keep.
+func Prune(ctx context.Context, filesystem fs.FS, root string, cfg Config, sets []*Set) error {
+	if len(sets) <= cfg.Keep {
+		return nil
+	}
+	for _, set := range sets[cfg.Keep:] {
+		if err := filesystem.RemoveAll(ctx, filepath.Join(root, cfg.Dir, set.ID+setSuffix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Protected returns the archives of the complete sets among the newest cfg.Keep.
+// Retention keeps them, so a complete set is never broken up by one host pruning.
+func Protected(root string, cfg Config, sets []*Set) map[string]bool {
+	out := make(map[string]bool)
+	if !cfg.Protect {
+		return out
+	}
+	for i, set := range sets {
+		if i >= cfg.Keep {
+			break
+		}
+		if !set.Complete {
+			continue
+		}
+		for _, m := range set.Members {
+			out[set.Path(root, m)] = true
+		}
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+package clusterset
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/cluster"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+// writePrimary stores an archive and its sidecar for a primary serving slots.
+func writePrimary(t *testing.T, root, host string, at time.Time, slots ...cluster.SlotRange) {
+	t.Helper()
+	dir := filepath.Join(root, host, "snapshots")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ts := snapshot.FormatTimestamp(at)
+	m := manifest.New()
+	m.Snapshot = ts
+	m.Cluster = &manifest.Cluster{Topology: cluster.Topology{
+		Myself: &cluster.Node{ID: host + "-id", Role: cluster.RoleMaster, Slots: slots},
+	}}
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ts+".tar.zst"), []byte("archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ts+manifest.SidecarSuffix), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	anchor := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		foreign     []cluster.SlotRange // slots of the third primary
+		wantMembers int
+		wantInvalid int
+		wantMissing int
+	}{
+		{"complete", []cluster.SlotRange{{Start: 10000, End: 16383}}, 3, 0, 0},
+		{"gap", []cluster.SlotRange{{Start: 10000, End: 16000}}, 3, 0, 383},
+		{"end beyond the last slot", []cluster.SlotRange{{Start: 10000, End: 20000}}, 2, 1, 6384},
+		{"negative start", []cluster.SlotRange{{Start: -1, End: 16383}}, 2, 1, 6384},
+		{"reversed", []cluster.SlotRange{{Start: 16383, End: 10000}}, 2, 1, 6384},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writePrimary(t, root, "a", anchor, cluster.SlotRange{Start: 0, End: 4999})
+			writePrimary(t, root, "b", anchor.Add(time.Minute), cluster.SlotRange{Start: 5000, End: 9999})
+			writePrimary(t, root, "c", anchor.Add(-time.Minute), tt.foreign...)
+
+			cfg := Config{Rule: "snapshots"}
+			cfg.ApplyDefaults()
+			set, err := Assemble(context.Background(), fs.New(fs.Config{}), root, cfg, anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(set.Members) != tt.wantMembers || len(set.Invalid) != tt.wantInvalid {
+				t.Fatalf("%d members, %d invalid; want %d and %d", len(set.Members), len(set.Invalid), tt.wantMembers, tt.wantInvalid)
+			}
+			if got := set.MissingCount(); got != tt.wantMissing {
+				t.Fatalf("%d slots missing, want %d", got, tt.wantMissing)
+			}
+			if set.Complete != (tt.wantMissing == 0) {
+				t.Fatalf("Complete = %v with %d slots missing", set.Complete, tt.wantMissing)
+			}
+		})
+	}
+}
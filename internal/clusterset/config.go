@@ -0,0 +1,30 @@
+package clusterset
+
+import "time"
+
+// Config enables grouping of per-host snapshots into cluster snapshot sets.
+type Config struct {
+	Enabled   bool   `yaml:"enabled"`
+	Dir       string `yaml:"dir"`       // folder under destination.root holding set manifests
+	Rule      string `yaml:"rule"`      // rule folder grouped into sets (default: the snapshot folder)
+	Tolerance string `yaml:"tolerance"` // max distance of a member snapshot from the set anchor
+	Keep      int    `yaml:"keep"`      // newest set manifests kept
+	Protect   bool   `yaml:"protect"`   // retention never removes members of kept complete sets
+}
+
+func (c *Config) ApplyDefaults() {
+	if c.Dir == "" {
+		c.Dir = "clustersets"
+	}
+	if _, err := time.ParseDuration(c.Tolerance); c.Tolerance == "" || err != nil {
+		c.Tolerance = "5m"
+	}
+	if c.Keep <= 0 {
+		c.Keep = 10
+	}
+}
+
+func (c *Config) tolerance() time.Duration {
+	d, _ := time.ParseDuration(c.Tolerance)
+	return d
+}
@@ -45,6 +45,7 @@ func (c *Config) ApplyDefaults() {
 	c.FS.ApplyDefaults()
 	c.Logging.ApplyDefaults()
 	c.Health.ApplyDefaults()
+	c.Scrub.ApplyDefaults()
 	c.ConfigReload.ApplyDefaults()
 }
 
@@ -0,0 +1,36 @@
+package crypt
+
+// Config selects the encryption of a destination's archives.
+type Config struct {
+	Mode string `yaml:"mode"` // off | age | aes
+
+	// age: X25519 recipients (age1...), inline and/or one per line in a file.
+	Recipients     []string `yaml:"recipients"`
+	RecipientsFile string   `yaml:"recipientsFile"`
+	// age: private keys used by restore and verify.
+	IdentityFile string `yaml:"identityFile"`
+
+	// aes: key ring with one "<key id> <base64 32-byte key>" per line. The
+	// first key encrypts; the others stay available for decryption.
+	KeyFile string `yaml:"keyFile"`
+}
+
+func (c *Config) ApplyDefaults() {
+	if c.Mode == "" {
+		c.Mode = ModeOff
+	}
+}
+
+// Enabled reports whether archives are encrypted.
+func (c Config) Enabled() bool { return c.Mode != "" && c.Mode != ModeOff }
+
+// Files lists the key files of c, which are watched for changes.
+func (c Config) Files() []string {
+	var files []string
+	for _, f := range []string{c.RecipientsFile, c.IdentityFile, c.KeyFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
@@ -0,0 +1,291 @@
+// Package crypt seals compressed archives before they leave the host. Each
+// archive gets a fresh data key; only that key is wrapped for the configured
+// age recipients or AES key ring entry, so keys can rotate without touching
+// existing archives. A small plaintext header records how the archive was
+// sealed and which key IDs can open it.
+package crypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+)
+
+const (
+	ModeOff = "off"
+	ModeAge = "age"
+	ModeAES = "aes"
+
+	// magic starts every sealed archive, followed by the big-endian length of
+	// the JSON header.
+	magic         = "RDBXENC1"
+	maxHeaderSize = 1 << 20
+	headerVersion = 1
+
+	keySize   = 32 // AES-256
+	chunkSize = 64 << 10
+)
+
+// ErrNoKey is returned when none of the loaded keys opens an archive.
+var ErrNoKey = errors.New("no matching decryption key")
+
+// Header is the plaintext envelope in front of a sealed archive.
+type Header struct {
+	Version int      `json:"version"`
+	Mode    string   `json:"mode"`   // "age" or "aes"
+	KeyIDs  []string `json:"keyIds"` // age: recipients; aes: key ring entry
+	// aes only: the data key wrapped with the key ring entry, the nonce
+	// prefix of the payload chunks and the chunk size.
+	WrappedKey []byte `json:"wrappedKey,omitempty"`
+	Nonce      []byte `json:"nonce,omitempty"`
+	ChunkSize  int    `json:"chunkSize,omitempty"`
+}
+
+// aad binds the header fields to the wrapped data key.
+func (h *Header) aad() []byte {
+	return fmt.Appendf(nil, "%s|%d|%s|%x|%d", magic, h.Version, strings.Join(h.KeyIDs, ","), h.Nonce, h.ChunkSize)
+}
+
+// Sealer encrypts archives for one destination. It implements fs.Sealer.
+type Sealer struct {
+	mode       string
+	recipients []*age.X25519Recipient
+	key        Key
+}
+
+// NewSealer loads the encryption keys of cfg. It returns nil when cfg is off.
+func NewSealer(cfg Config) (*Sealer, error) {
+	switch cfg.Mode {
+	case "", ModeOff:
+		return nil, nil
+	case ModeAge:
+		recipients, err := readRecipients(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &Sealer{mode: ModeAge, recipients: recipients}, nil
+	case ModeAES:
+		if cfg.KeyFile == "" {
+			return nil, errors.New("aes encryption needs a keyFile")
+		}
+		ring, err := ReadKeyRing(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &Sealer{mode: ModeAES, key: ring[0]}, nil
+	default:
+		return nil, fmt.Errorf("unknown encryption mode %q", cfg.Mode)
+	}
+}
+
+// KeyIDs returns the IDs recorded in the header of new archives.
+func (s *Sealer) KeyIDs() []string {
+	if s.mode == ModeAES {
+		return []string{s.key.ID}
+	}
+	ids := make([]string, len(s.recipients))
+	for i, r := range s.recipients {
+		ids[i] = r.String()
+	}
+	return ids
+}
+
+// Mode returns the encryption mode, "age" or "aes".
+func (s *Sealer) Mode() string { return s.mode }
+
+// Seal writes the header to w and returns the writer for the payload.
+func (s *Sealer) Seal(w io.Writer) (io.WriteCloser, error) {
+	h := &Header{Version: headerVersion, Mode: s.mode, KeyIDs: s.KeyIDs()}
+
+	if s.mode == ModeAge {
+		if err := writeHeader(w, h); err != nil {
+			return nil, err
+		}
+		recipients := make([]age.Recipient, len(s.recipients))
+		for i, r := range s.recipients {
+			recipients[i] = r
+		}
+		aw, err := age.Encrypt(w, recipients...)
+		if err != nil {
+			return nil, err
+		}
+		return &onceCloser{WriteCloser: aw}, nil
+	}
+
+	dataKey := make([]byte, keySize)
+	h.Nonce = make([]byte, noncePrefixSize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(h.Nonce); err != nil {
+		return nil, err
+	}
+	h.ChunkSize = chunkSize
+
+	wrapped, err := wrapKey(s.key.Key, dataKey, h.aad())
+	if err != nil {
+		return nil, err
+	}
+	h.WrappedKey = wrapped
+	if err := writeHeader(w, h); err != nil {
+		return nil, err
+	}
+	return newStreamWriter(w, dataKey, h.Nonce, h.ChunkSize)
+}
+
+// Unseal reads the header of a sealed archive from r and returns the
+// decrypted payload.
+func Unseal(r io.Reader, keys *Keys) (io.Reader, *Header, error) {
+	br := bufio.NewReader(r)
+	h, err := ReadHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	if keys == nil {
+		keys = &Keys{}
+	}
+
+	switch h.Mode {
+	case ModeAge:
+		if len(keys.Identities) == 0 {
+			return nil, h, fmt.Errorf("%w: archive is sealed for age recipients %s, no identityFile loaded", ErrNoKey, strings.Join(h.KeyIDs, ", "))
+		}
+		pr, err := age.Decrypt(br, keys.Identities...)
+		if err != nil {
+			return nil, h, fmt.Errorf("%w: %v", ErrNoKey, err)
+		}
+		return pr, h, nil
+
+	case ModeAES:
+		if len(h.KeyIDs) != 1 {
+			return nil, h, fmt.Errorf("invalid aes header: %d key ids", len(h.KeyIDs))
+		}
+		for _, k := range keys.Ring {
+			if k.ID != h.KeyIDs[0] {
+				continue
+			}
+			dataKey, err := unwrapKey(k.Key, h.WrappedKey, h.aad())
+			if err != nil {
+				return nil, h, fmt.Errorf("unwrapping data key with %q: %w", k.ID, err)
+			}
+			pr, err := newStreamReader(br, dataKey, h.Nonce, h.ChunkSize)
+			return pr, h, err
+		}
+		return nil, h, fmt.Errorf("%w: archive is sealed with key %q", ErrNoKey, h.KeyIDs[0])
+
+	default:
+		return nil, h, fmt.Errorf("unknown encryption mode %q", h.Mode)
+	}
+}
+
+// Open prepares the archive at path, read from r, for fs.ReadCompressedTar:
+// sealed archives are decrypted with keys transparently. h is nil for plain
+// archives.
+func Open(r io.Reader, path string, keys *Keys) (content io.Reader, codec fs.Codec, h *Header, err error) {
+	codec, ok := fs.CodecForPath(path)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unknown archive format: %s", path)
+	}
+	if !fs.IsSealed(path) {
+		return r, codec, nil, nil
+	}
+	content, h, err = Unseal(r, keys)
+	return content, codec, h, err
+}
+
+// ReadHeader reads the envelope header from r, leaving r at the payload.
+func ReadHeader(r io.Reader) (*Header, error) {
+	var pre [len(magic) + 4]byte
+	if _, err := io.ReadFull(r, pre[:]); err != nil {
+		return nil, fmt.Errorf("reading encryption header: %w", err)
+	}
+	if string(pre[:len(magic)]) != magic {
+		return nil, errors.New("not a sealed archive")
+	}
+	n := binary.BigEndian.Uint32(pre[len(magic):])
+	if n > maxHeaderSize {
+		return nil, fmt.Errorf("encryption header too large: %d bytes", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading encryption header: %w", err)
+	}
+	var h Header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("parsing encryption header: %w", err)
+	}
+	if h.Version != headerVersion {
+		return nil, fmt.Errorf("unsupported encryption header version %d", h.Version)
+	}
+	return &h, nil
+}
+
+func writeHeader(w io.Writer, h *Header) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 0, len(magic)+4+len(data))
+	buf = append(buf, magic...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	buf = append(buf, data...)
+	_, err = w.Write(buf)
+	return err
+}
+
+// wrapKey seals dataKey with kek; the random nonce is prepended.
+func wrapKey(kek, dataKey, aad []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, aad), nil
+}
+
+func unwrapKey(kek, wrapped, aad []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// onceCloser makes Close idempotent.
+type onceCloser struct {
+	io.WriteCloser
+	closed bool
+}
+
+func (c *onceCloser) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.WriteCloser.Close()
+}
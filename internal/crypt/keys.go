@@ -0,0 +1,114 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Key is one entry of an AES key ring.
+type Key struct {
+	ID  string
+	Key []byte // 32 bytes
+}
+
+// Keys holds the secrets needed to open sealed archives.
+type Keys struct {
+	Ring       []Key // aes; any entry may have sealed an archive
+	Identities []age.Identity
+}
+
+// LoadKeys reads the decryption keys named by cfg. Missing files are an error;
+// an empty result is not.
+func LoadKeys(cfg Config) (*Keys, error) {
+	keys := &Keys{}
+	if cfg.KeyFile != "" {
+		ring, err := ReadKeyRing(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys.Ring = ring
+	}
+	if cfg.IdentityFile != "" {
+		data, err := os.ReadFile(cfg.IdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading identity file: %w", err)
+		}
+		ids, err := age.ParseIdentities(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("parsing identity file %s: %w", cfg.IdentityFile, err)
+		}
+		keys.Identities = ids
+	}
+	return keys, nil
+}
+
+// ReadKeyRing parses an AES key ring file. Blank lines and lines starting
+// with '#' are ignored.
+func ReadKeyRing(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	var ring []Key
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"<key id> <base64 key>\"", path, n)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("%s:%d: key %q is not %d base64 encoded bytes", path, n, fields[0], keySize)
+		}
+		if seen[fields[0]] {
+			return nil, fmt.Errorf("%s:%d: duplicate key id %q", path, n, fields[0])
+		}
+		seen[fields[0]] = true
+		ring = append(ring, Key{ID: fields[0], Key: key})
+	}
+	if len(ring) == 0 {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return ring, nil
+}
+
+// readRecipients returns the age recipients of cfg.
+func readRecipients(cfg Config) ([]*age.X25519Recipient, error) {
+	lines := append([]string(nil), cfg.Recipients...)
+	if cfg.RecipientsFile != "" {
+		data, err := os.ReadFile(cfg.RecipientsFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading recipients file: %w", err)
+		}
+		lines = append(lines, strings.Split(string(data), "\n")...)
+	}
+
+	var out []*age.X25519Recipient
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := age.ParseX25519Recipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", line, err)
+		}
+		out = append(out, r)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("age encryption needs at least one recipient")
+	}
+	return out, nil
+}
@@ -0,0 +1,178 @@
+package crypt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The aes payload is a sequence of GCM sealed chunks of ChunkSize plaintext
+// bytes. Chunk nonces are the archive's random prefix, a big-endian counter
+// and a final flag, so chunks cannot be reordered and truncation is detected.
+const (
+	noncePrefixSize = 7
+	maxChunks       = 1<<32 - 1
+)
+
+func chunkNonce(prefix []byte, n uint32, last bool) []byte {
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, n)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+type streamWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	buf    []byte
+	out    []byte
+	n      uint32
+	closed bool
+	err    error
+}
+
+func newStreamWriter(w io.Writer, key, prefix []byte, size int) (*streamWriter, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, 0, size),
+		out:    make([]byte, 0, size+aead.Overhead()),
+	}, nil
+}
+
+// Write buffers p; a full chunk is only sealed once more data follows, so the
+// last chunk can always be flagged as such on Close.
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to closed stream")
+	}
+	n := 0
+	for len(p) > 0 && s.err == nil {
+		if len(s.buf) == cap(s.buf) {
+			s.flush(false)
+			continue
+		}
+		k := min(len(p), cap(s.buf)-len(s.buf))
+		s.buf = append(s.buf, p[:k]...)
+		p, n = p[k:], n+k
+	}
+	return n, s.err
+}
+
+func (s *streamWriter) flush(last bool) {
+	if s.n == maxChunks {
+		s.err = errors.New("encrypted stream too long")
+		return
+	}
+	s.out = s.aead.Seal(s.out[:0], chunkNonce(s.prefix, s.n, last), s.buf, nil)
+	s.n++
+	s.buf = s.buf[:0]
+	if _, err := s.w.Write(s.out); err != nil {
+		s.err = err
+	}
+}
+
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.err == nil {
+		s.flush(true)
+	}
+	return s.err
+}
+
+type streamReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	in     []byte
+	pbuf   []byte
+	plain  []byte
+	n      uint32
+	done   bool
+	err    error
+}
+
+func newStreamReader(r io.Reader, key, prefix []byte, size int) (*streamReader, error) {
+	if len(prefix) != noncePrefixSize || size <= 0 || size > 16<<20 {
+		return nil, errors.New("invalid aes stream parameters")
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	// One extra byte tells a full middle chunk from a full last one.
+	return &streamReader{
+		r:      r,
+		aead:   aead,
+		prefix: prefix,
+		in:     make([]byte, 0, size+aead.Overhead()+1),
+		pbuf:   make([]byte, 0, size),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.next()
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next decrypts the following chunk into s.plain.
+func (s *streamReader) next() {
+	full := cap(s.in) - 1
+	// s.in may hold the look-ahead byte of the previous chunk.
+	n, err := io.ReadFull(s.r, s.in[len(s.in):cap(s.in)])
+	s.in = s.in[:len(s.in)+n]
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		s.err = err
+		return
+	}
+
+	chunk := s.in
+	if !last {
+		chunk = s.in[:full]
+	}
+	if len(chunk) < s.aead.Overhead() {
+		s.err = fmt.Errorf("encrypted stream truncated at chunk %d", s.n)
+		return
+	}
+	plain, err := s.aead.Open(s.pbuf[:0], chunkNonce(s.prefix, s.n, last), chunk, nil)
+	if err != nil {
+		s.err = fmt.Errorf("decrypting chunk %d: %w", s.n, err)
+		return
+	}
+	s.n++
+	s.plain = plain
+	if last {
+		s.done = true
+		return
+	}
+	// Keep the look-ahead byte for the next chunk.
+	s.in = append(s.in[:0], s.in[full])
+}
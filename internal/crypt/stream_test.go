@@ -0,0 +1,176 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+const testChunk = 16
+
+// seal encrypts plain as a stream of testChunk byte chunks.
+func seal(t *testing.T, key, prefix, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newStreamWriter(&buf, key, prefix, testChunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func open(key, prefix, sealed []byte) ([]byte, error) {
+	r, err := newStreamReader(bytes.NewReader(sealed), key, prefix, testChunk)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func testKey(t *testing.T) (key, prefix []byte) {
+	t.Helper()
+	key, prefix = make([]byte, keySize), make([]byte, noncePrefixSize)
+	_, _ = rand.Read(key)
+	_, _ = rand.Read(prefix)
+	return key, prefix
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key, prefix := testKey(t)
+	for _, n := range []int{0, 1, testChunk - 1, testChunk, testChunk + 1, 2 * testChunk, 100} {
+		plain := make([]byte, n)
+		_, _ = rand.Read(plain)
+		sealed := seal(t, key, prefix, plain)
+
+		chunks := max(1, (n+testChunk-1)/testChunk)
+		if want := n + chunks*16; len(sealed) != want {
+			t.Fatalf("%d bytes sealed to %d, want %d", n, len(sealed), want)
+		}
+		got, err := open(key, prefix, sealed)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("%d bytes: round trip differs", n)
+		}
+	}
+}
+
+func TestStreamTamper(t *testing.T) {
+	key, prefix := testKey(t)
+	const sealedChunk = testChunk + 16 // plaintext and GCM tag
+	plain := make([]byte, 3*testChunk+5)
+	_, _ = rand.Read(plain)
+	sealed := seal(t, key, prefix, plain) // three full chunks and a short last one
+
+	aligned := seal(t, key, prefix, plain[:2*testChunk]) // two full chunks, the second last
+
+	swap := func(b []byte, i, j int) []byte {
+		out := bytes.Clone(b)
+		copy(out[i*sealedChunk:], b[j*sealedChunk:(j+1)*sealedChunk])
+		copy(out[j*sealedChunk:], b[i*sealedChunk:(i+1)*sealedChunk])
+		return out
+	}
+	flip := func(b []byte, i int) []byte {
+		out := bytes.Clone(b)
+		out[i] ^= 1
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		key    []byte
+		prefix []byte
+	}{
+		{"final chunk dropped", sealed[:3*sealedChunk], key, prefix},
+		{"full final chunk dropped", aligned[:sealedChunk], key, prefix},
+		{"truncated in the final chunk", sealed[:len(sealed)-1], key, prefix},
+		{"truncated in a middle chunk", sealed[:sealedChunk+10], key, prefix},
+		{"truncated to nothing", nil, key, prefix},
+		{"chunks reordered", swap(sealed, 0, 1), key, prefix},
+		{"final chunk moved", append(bytes.Clone(aligned[sealedChunk:]), aligned[:sealedChunk]...), key, prefix},
+		{"bit flipped", flip(sealed, sealedChunk+3), key, prefix},
+		{"tag flipped", flip(sealed, len(sealed)-1), key, prefix},
+		{"data appended", append(bytes.Clone(sealed), make([]byte, sealedChunk)...), key, prefix},
+		{"chunks of another stream", append(bytes.Clone(sealed[:sealedChunk]), seal(t, key, flip(prefix, 0), plain)[sealedChunk:]...), key, prefix},
+		{"wrong prefix", sealed, key, flip(prefix, 0)},
+		{"wrong key", sealed, flip(key, 0), prefix},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := open(tt.key, tt.prefix, tt.sealed); err == nil {
+				t.Fatalf("tampered stream opened to %d bytes", len(got))
+			}
+		})
+	}
+}
+
+func TestSealHeaderTamper(t *testing.T) {
+	kek, _ := testKey(t)
+	s := &Sealer{mode: ModeAES, key: Key{ID: "k1", Key: kek}}
+	keys := &Keys{Ring: []Key{{ID: "k1", Key: kek}}}
+	plain := bytes.Repeat([]byte("snapshot"), 20000) // several chunks
+
+	var buf bytes.Buffer
+	w, err := s.Seal(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _, err := Unseal(bytes.NewReader(buf.Bytes()), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("round trip: %d bytes, %v", len(got), err)
+	}
+
+	// Header fields are bound to the wrapped data key.
+	br := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	h, err := ReadHeader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := io.ReadAll(br)
+	for name, change := range map[string]func(h *Header){
+		"chunk size": func(h *Header) { h.ChunkSize /= 2 },
+		"nonce":      func(h *Header) { h.Nonce[0] ^= 1 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			hh := *h
+			hh.Nonce = bytes.Clone(h.Nonce)
+			change(&hh)
+			var tampered bytes.Buffer
+			if err := writeHeader(&tampered, &hh); err != nil {
+				t.Fatal(err)
+			}
+			tampered.Write(payload)
+			r, _, err := Unseal(&tampered, keys)
+			if err == nil {
+				_, err = io.ReadAll(r)
+			}
+			if err == nil {
+				t.Fatal("archive with a tampered header opened")
+			}
+		})
+	}
+
+	if _, _, err := Unseal(bytes.NewReader(buf.Bytes()), &Keys{Ring: []Key{{ID: "k2", Key: kek}}}); err == nil {
+		t.Fatal("archive opened without its key")
+	}
+}
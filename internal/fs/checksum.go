@@ -0,0 +1,62 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// Checksums are the SHA-256 digests computed while an archive is written:
+// one for the archive as stored and one per tar member.
+type Checksums struct {
+	Archive Digest   `json:"archive"`
+	Members []Digest `json:"members"`
+}
+
+// Digest is the SHA-256 of a byte stream.
+type Digest struct {
+	Name   string `json:"name,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Member returns the digest recorded for the tar member name.
+func (c *Checksums) Member(name string) (Digest, bool) {
+	for _, d := range c.Members {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Digest{}, false
+}
+
+// Hasher computes a Digest of everything written to it.
+type Hasher struct {
+	h hash.Hash
+	n int64
+}
+
+func NewHasher() *Hasher { return &Hasher{h: sha256.New()} }
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.n += int64(len(p))
+	return h.h.Write(p)
+}
+
+// Digest returns the digest of the bytes written so far.
+func (h *Hasher) Digest(name string) Digest {
+	return Digest{Name: name, Size: h.n, SHA256: hex.EncodeToString(h.h.Sum(nil))}
+}
+
+// hashingWriter passes writes through to w while hashing them.
+type hashingWriter struct {
+	w io.Writer
+	h *Hasher
+}
+
+func (hw hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	_, _ = hw.h.Write(p[:n])
+	return n, err
+}
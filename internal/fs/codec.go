@@ -0,0 +1,243 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	// DefaultCodec is used when a destination does not name one.
+	DefaultCodec = "zstd"
+	// SealedExt follows the codec extension of encrypted archives.
+	SealedExt = ".enc"
+)
+
+// Codec compresses the tar stream of an archive. The archive extension is
+// derived from the codec, so archives of every codec can live side by side.
+type Codec interface {
+	Name() string
+	Ext() string // full archive extension, e.g. ".tar.zst"
+	// NewWriter compresses into w. A level <= 0 selects the codec default;
+	// levels beyond what the codec supports are clamped.
+	NewWriter(w io.Writer, opts EncoderOptions) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// trailerCodec is implemented by codecs whose streams end in a fixed trailer,
+// which tells a complete archive from a truncated one without decoding it.
+type trailerCodec interface {
+	// complete reports whether tail, at least TailSize bytes or the whole
+	// archive, ends with the trailer.
+	complete(tail []byte) bool
+}
+
+// TailSize is the length of archive tail CheckTail needs.
+const TailSize = 1024
+
+// CheckTail reports whether tail, the last TailSize bytes of the archive at
+// path, ends the way its format does. known is false for sealed archives and
+// codecs without a fixed trailer, such as zstd and gzip.
+func CheckTail(path string, tail []byte) (complete, known bool) {
+	c, ok := CodecForPath(path)
+	if !ok || IsSealed(path) {
+		return false, false
+	}
+	tc, ok := c.(trailerCodec)
+	if !ok {
+		return false, false
+	}
+	return tc.complete(tail), true
+}
+
+var codecs = map[string]Codec{}
+
+func registerCodec(c Codec) { codecs[c.Name()] = c }
+
+func init() {
+	registerCodec(zstdCodec{})
+	registerCodec(gzipCodec{})
+	registerCodec(lz4Codec{})
+	registerCodec(xzCodec{})
+	registerCodec(noneCodec{})
+}
+
+// CodecByName returns the named codec; "" is the default codec.
+func CodecByName(name string) (Codec, error) {
+	if name == "" {
+		name = DefaultCodec
+	}
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q (supported: %s)", name, strings.Join(CodecNames(), ", "))
+	}
+	return c, nil
+}
+
+// CodecNames lists the registered codecs.
+func CodecNames() []string {
+	names := make([]string, 0, len(codecs))
+	for n := range codecs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CodecForPath returns the codec that wrote the archive at path, by extension.
+// Sealed archives report the codec of their content.
+func CodecForPath(path string) (Codec, bool) {
+	path = strings.TrimSuffix(path, SealedExt)
+	var best Codec
+	for _, c := range codecs {
+		if strings.HasSuffix(path, c.Ext()) && (best == nil || len(c.Ext()) > len(best.Ext())) {
+			best = c
+		}
+	}
+	return best, best != nil
+}
+
+// TrimArchiveExt strips any known archive extension, sealed or not, from
+// name. ok is false when name is not an archive.
+func TrimArchiveExt(name string) (base string, ok bool) {
+	c, ok := CodecForPath(name)
+	if !ok {
+		return name, false
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(name, SealedExt), c.Ext()), true
+}
+
+// IsSealed reports whether the archive at path is encrypted.
+func IsSealed(path string) bool {
+	return strings.HasSuffix(path, SealedExt) && IsArchive(path)
+}
+
+// ArchiveExts lists every archive extension, plain and sealed.
+func ArchiveExts() []string {
+	var exts []string
+	for _, name := range CodecNames() {
+		ext := codecs[name].Ext()
+		exts = append(exts, ext, ext+SealedExt)
+	}
+	return exts
+}
+
+// IsArchive reports whether name carries a known archive extension.
+func IsArchive(name string) bool {
+	_, ok := CodecForPath(name)
+	return ok
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd" }
+func (zstdCodec) Ext() string  { return ".tar.zst" }
+
+func (zstdCodec) NewWriter(w io.Writer, opts EncoderOptions) (io.WriteCloser, error) {
+	return newZstdWriter(w, opts)
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return dec.IOReadCloser(), nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+func (gzipCodec) Ext() string  { return ".tar.gz" }
+
+func (gzipCodec) NewWriter(w io.Writer, opts EncoderOptions) (io.WriteCloser, error) {
+	level := opts.Level
+	if level <= 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, min(level, gzip.BestCompression))
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type lz4Codec struct{}
+
+func (lz4Codec) Name() string { return "lz4" }
+func (lz4Codec) Ext() string  { return ".tar.lz4" }
+
+func (lz4Codec) NewWriter(w io.Writer, opts EncoderOptions) (io.WriteCloser, error) {
+	zw := lz4.NewWriter(w)
+	lvl := lz4.Fast
+	if opts.Level > 0 {
+		// lz4.Level1..Level9 are powers of two starting at 1<<9.
+		lvl = lz4.CompressionLevel(1 << (8 + min(opts.Level, 9)))
+	}
+	if err := zw.Apply(lz4.CompressionLevelOption(lvl), lz4.ChecksumOption(true)); err != nil {
+		return nil, err
+	}
+	return zw, nil
+}
+
+func (lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
+
+// complete checks for the zero end mark, followed by the content checksum.
+func (lz4Codec) complete(tail []byte) bool {
+	return len(tail) >= 8 && bytes.Equal(tail[len(tail)-8:len(tail)-4], make([]byte, 4))
+}
+
+// xzCodec has no compression levels; level is ignored.
+type xzCodec struct{}
+
+func (xzCodec) Name() string { return "xz" }
+func (xzCodec) Ext() string  { return ".tar.xz" }
+
+func (xzCodec) NewWriter(w io.Writer, opts EncoderOptions) (io.WriteCloser, error) {
+	return xz.NewWriter(w)
+}
+
+func (xzCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(zr), nil
+}
+
+// complete checks for the magic bytes closing the stream footer.
+func (xzCodec) complete(tail []byte) bool {
+	return bytes.HasSuffix(tail, []byte("YZ"))
+}
+
+// noneCodec stores a plain tar.
+type noneCodec struct{}
+
+func (noneCodec) Name() string { return "none" }
+func (noneCodec) Ext() string  { return ".tar" }
+
+func (noneCodec) NewWriter(w io.Writer, opts EncoderOptions) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+// complete checks for the two zero blocks ending a tar.
+func (noneCodec) complete(tail []byte) bool {
+	return len(tail) >= 1024 && bytes.Equal(tail[len(tail)-1024:], make([]byte, 1024))
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,51 @@
+package fs
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckTail(t *testing.T) {
+	src := t.TempDir()
+	data := make([]byte, 256<<10)
+	_, _ = rand.Read(data)
+	if err := os.WriteFile(filepath.Join(src, "dump.rdb"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	o := New(Config{MaxRetries: 1, RetryBase: "1ms", RetryDurationCap: "1ms"})
+
+	for _, name := range CodecNames() {
+		t.Run(name, func(t *testing.T) {
+			c, err := CodecByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst := filepath.Join(t.TempDir(), "a"+c.Ext())
+			if _, err := o.CreateCompressedTar(context.Background(), src, []string{"dump.rdb"}, dst, ArchiveOptions{Codec: c}); err != nil {
+				t.Fatal(err)
+			}
+			archive, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			complete, known := CheckTail(dst, archive[len(archive)-TailSize:])
+			if !known {
+				if name != "zstd" && name != "gzip" {
+					t.Fatalf("no trailer check for %s", name)
+				}
+				return
+			}
+			if !complete {
+				t.Fatal("complete archive reported as truncated")
+			}
+			cut := archive[:len(archive)-TailSize-1]
+			if complete, _ := CheckTail(dst, cut[len(cut)-TailSize:]); complete {
+				t.Fatal("truncated archive reported as complete")
+			}
+		})
+	}
+}
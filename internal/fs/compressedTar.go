@@ -7,57 +7,122 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-
-	"github.com/klauspost/compress/zstd"
+	"time"
 )
 
+// sink is the destination of an archive. Commit makes the written bytes durable,
+// Abort discards them. Exactly one of the two is called per sink.
+type sink interface {
+	io.Writer
+	Commit() error
+	Abort()
+}
+
+// fileSink writes an archive into a local file.
+type fileSink struct {
+	f *os.File
+}
+
+func newFileSink(path string) (sink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) Write(p []byte) (int, error) { return s.f.Write(p) }
+
+func (s *fileSink) Commit() error {
+	if err := s.f.Sync(); err != nil {
+		_ = s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+func (s *fileSink) Abort() {
+	_ = s.f.Close()
+	_ = os.Remove(s.f.Name())
+}
+
 // createCompressedTarWithRetry creates a tar+compressed archive of the given files
-// (relative to srcDir) into dst, with retry and source-change detection.
-func createCompressedTarWithRetry(ctx context.Context, f FS, cfg Config, srcDir string, files []string, dst string) error {
+// (relative to srcDir) into the sink returned by open, with retry and source-change detection.
+// Source files are always read from the local filesystem src. It returns the
+// checksums of the attempt that succeeded.
+func createCompressedTarWithRetry(ctx context.Context, src FS, cfg Config, srcDir string, files []string, opts ArchiveOptions, open func() (sink, error)) (Checksums, error) {
 	// Capture original metadata for all files.
 	orig := make(map[string]FileInfo, len(files))
 	for _, name := range files {
 		full := filepath.Join(srcDir, name)
-		fi, err := f.Stat(full)
+		fi, err := src.Stat(ctx, full)
 		if err != nil {
-			return fmt.Errorf("stat %s: %w", full, err)
+			return Checksums{}, fmt.Errorf("stat %s: %w", full, err)
 		}
 		orig[name] = fi
 	}
 
 	op := Operation{Name: "compress-tar"}
 
-	return retry(ctx, cfg, op, func() error {
+	var sums Checksums
+	err := retry(ctx, cfg, op, func() error {
 		// Re-check all files before each attempt.
 		for _, name := range files {
 			full := filepath.Join(srcDir, name)
-			now, err := f.Stat(full)
+			now, err := src.Stat(ctx, full)
 			if err != nil {
 				return fmt.Errorf("stat %s: %w", full, err)
 			}
+			if limit, ok := opts.Limits[name]; ok {
+				if sourceReplaced(orig[name], now, limit) {
+					return fmt.Errorf("source replaced during compression: %s", full)
+				}
+				continue
+			}
 			if sourceChanged(orig[name], now) {
 				return fmt.Errorf("source changed during compression: %s", full)
 			}
 		}
 
-		return createCompressedTarOnce(srcDir, files, dst, cfg.CompressionLevel)
+		out, err := open()
+		if err != nil {
+			return err
+		}
+		level := opts.Level
+		if level <= 0 {
+			level = cfg.CompressionLevel
+		}
+		sums, err = writeCompressedTar(ctx, out, srcDir, files, opts, cfg.Zstd.EncoderOptions(level))
+		if err != nil {
+			out.Abort()
+			return err
+		}
+		return out.Commit()
 	})
+	return sums, err
 }
 
-func createCompressedTarOnce(srcDir string, files []string, dst string, level int) error {
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = out.Close() }()
+// writeCompressedTar streams a compressed tar archive of files, followed by the extra members, into out.
+// Members and the archive are hashed on the way. Cancelling ctx stops it between reads.
+func writeCompressedTar(ctx context.Context, out io.Writer, srcDir string, files []string, opts ArchiveOptions, encOpts EncoderOptions) (sums Checksums, err error) {
+	archiveHash := NewHasher()
+	out = hashingWriter{w: out, h: archiveHash}
 
-	// zstd encoder with configurable level.
-	if level <= 0 {
-		level = 2 // sane default if not set
+	codec := opts.Codec
+	if codec == nil {
+		codec, _ = CodecByName(DefaultCodec)
+	}
+	var sealed io.WriteCloser
+	if opts.Seal != nil {
+		if sealed, err = opts.Seal.Seal(out); err != nil {
+			return sums, fmt.Errorf("sealing archive: %w", err)
+		}
+		defer sealed.Close()
+		out = sealed
 	}
-	enc, err := zstd.NewWriter(out, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	enc, err := codec.NewWriter(out, encOpts)
 	if err != nil {
-		return fmt.Errorf("creating zstd writer: %w", err)
+		return sums, fmt.Errorf("creating %s writer: %w", codec.Name(), err)
 	}
 	defer enc.Close()
 
@@ -69,38 +134,110 @@ func createCompressedTarOnce(srcDir string, files []string, dst string, level in
 
 		st, err := os.Stat(full)
 		if err != nil {
-			return fmt.Errorf("stat %s: %w", full, err)
+			return sums, fmt.Errorf("stat %s: %w", full, err)
 		}
 
 		hdr, err := tar.FileInfoHeader(st, "")
 		if err != nil {
-			return fmt.Errorf("tar header %s: %w", full, err)
+			return sums, fmt.Errorf("tar header %s: %w", full, err)
 		}
 		// Preserve relative path inside archive.
-		hdr.Name = name
+		hdr.Name = filepath.ToSlash(name)
+		limit, limited := opts.Limits[name]
+		if limited {
+			hdr.Size = limit
+		}
 
 		if err := tw.WriteHeader(hdr); err != nil {
-			return fmt.Errorf("tar write header %s: %w", full, err)
+			return sums, fmt.Errorf("tar write header %s: %w", full, err)
 		}
 
 		in, err := os.Open(full)
 		if err != nil {
-			return fmt.Errorf("open %s: %w", full, err)
+			return sums, fmt.Errorf("open %s: %w", full, err)
 		}
 
-		if _, err := io.Copy(tw, in); err != nil {
+		h := NewHasher()
+		dst := hashingWriter{w: tw, h: h}
+		r := ctxReader{ctx: ctx, r: in}
+		if limited {
+			_, err = io.CopyN(dst, r, limit)
+		} else {
+			_, err = io.Copy(dst, r)
+		}
+		if err != nil {
 			_ = in.Close()
-			return fmt.Errorf("copy %s: %w", full, err)
+			return sums, fmt.Errorf("copy %s: %w", full, err)
 		}
 		_ = in.Close()
+		sums.Members = append(sums.Members, h.Digest(hdr.Name))
 	}
 
-	// Flush tar + zstd + file.
+	now := time.Now()
+	for _, m := range opts.Extra {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     m.Name,
+			Mode:     0o644,
+			Size:     int64(len(m.Data)),
+			ModTime:  now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return sums, fmt.Errorf("tar write header %s: %w", m.Name, err)
+		}
+		if _, err := tw.Write(m.Data); err != nil {
+			return sums, fmt.Errorf("write %s: %w", m.Name, err)
+		}
+		h := NewHasher()
+		_, _ = h.Write(m.Data)
+		sums.Members = append(sums.Members, h.Digest(m.Name))
+	}
+
+	// Flush tar + compressor + sealer.
 	if err := tw.Close(); err != nil {
-		return err
+		return sums, err
 	}
 	if err := enc.Close(); err != nil {
-		return err
+		return sums, err
+	}
+	if sealed != nil {
+		if err := sealed.Close(); err != nil {
+			return sums, err
+		}
+	}
+	sums.Archive = archiveHash.Digest("")
+	return sums, nil
+}
+
+// ReadCompressedTar decodes a tar stream compressed with codec and calls visit
+// for every regular file member. The stream is read to the end so the codec
+// checksums are verified even when visit does not consume a member.
+func ReadCompressedTar(r io.Reader, codec Codec, visit func(hdr *tar.Header, body io.Reader) error) error {
+	dec, err := codec.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("creating %s reader: %w", codec.Name(), err)
+	}
+	defer dec.Close()
+
+	tr := tar.NewReader(dec)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(hdr, tr); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.Copy(io.Discard, dec); err != nil {
+		return fmt.Errorf("reading %s stream: %w", codec.Name(), err)
 	}
-	return out.Sync()
+	return nil
 }
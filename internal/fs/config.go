@@ -3,10 +3,11 @@
 import "time"
 
 type Config struct {
-	MaxRetries       int    `yaml:"maxRetries"`
-	RetryBase        string `yaml:"retryBase"`
-	RetryDurationCap string `yaml:"retryDurationCap"`
-	CompressionLevel int    `yaml:"compressionLevel"`
+	MaxRetries       int        `yaml:"maxRetries"`
+	RetryBase        string     `yaml:"retryBase"`
+	RetryDurationCap string     `yaml:"retryDurationCap"`
+	CompressionLevel int        `yaml:"compressionLevel"`
+	Zstd             ZstdConfig `yaml:"zstd"`
 }
 
 func (c *Config) ApplyDefaults() {
@@ -28,3 +29,42 @@ func isValidDuration(s string) bool {
 	_, err := time.ParseDuration(s)
 	return err == nil
 }
+
+// S3Config describes an S3-compatible bucket used as archive destination.
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"` // e.g. "https://s3.eu-west-1.amazonaws.com", "http://minio:9000"
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	SessionToken    string `yaml:"sessionToken"`
+	PathStyle       bool   `yaml:"pathStyle"`  // required by most S3-compatible stores
+	PartSizeMB      int    `yaml:"partSizeMB"` // multipart upload/copy part size, see partSizeFor
+	// RequestTimeout bounds the wait for the response headers of a request,
+	// so a stalled endpoint fails over to a retry instead of hanging.
+	RequestTimeout string `yaml:"requestTimeout"`
+}
+
+func (c *S3Config) ApplyDefaults() {
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.PartSizeMB < 5 {
+		c.PartSizeMB = 16 // S3 minimum is 5 MiB
+	}
+	if d, err := time.ParseDuration(c.RequestTimeout); c.RequestTimeout == "" || err != nil || d <= 0 {
+		c.RequestTimeout = "2m"
+	}
+}
+
+func (c S3Config) partSize() int64 {
+	return int64(c.PartSizeMB) << 20
+}
+
+func (c S3Config) requestTimeout() time.Duration {
+	d, err := time.ParseDuration(c.RequestTimeout)
+	if err != nil || d <= 0 {
+		return 2 * time.Minute
+	}
+	return d
+}
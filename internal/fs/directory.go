@@ -11,7 +11,7 @@ func copyDirWithRetry(ctx context.Context, f FS, cfg Config, src, dst string) er
 		return err
 	}
 
-	entries, err := f.ReadDir(src)
+	entries, err := f.ReadDir(ctx, src)
 	if err != nil {
 		return err
 	}
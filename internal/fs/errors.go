@@ -9,6 +9,12 @@ import (
 // These cases are common on networked or RWM storage where brief contention,
 // I/O stalls, or resource pressure can resolve on retry.
 func isTransient(err error) bool {
+	// Remote backends classify their own failures (5xx, throttling, connection resets).
+	var t interface{ transient() bool }
+	if errors.As(err, &t) && t.transient() {
+		return true
+	}
+
 	switch {
 	// EAGAIN — Resource temporarily unavailable.
 	// Often returned when the FS is momentarily busy or a lock cannot be acquired.
@@ -11,13 +11,13 @@ import (
 // It ensures that snapshotwatcher copies are consistent and aborts if the source file changes mid-copy.
 
 func copyWithRetry(ctx context.Context, f FS, cfg Config, src, dst string) error {
-	orig, err := f.Stat(src)
+	orig, err := f.Stat(ctx, src)
 	if err != nil {
 		return err
 	}
 
 	return retry(ctx, cfg, Operation{Name: "copy"}, func() error {
-		now, err := f.Stat(src)
+		now, err := f.Stat(ctx, src)
 		if err != nil {
 			return err
 		}
@@ -26,7 +26,7 @@ func copyWithRetry(ctx context.Context, f FS, cfg Config, src, dst string) error
 			return fmt.Errorf("source changed during copy")
 		}
 
-		return copyOnce(src, dst)
+		return copyOnce(ctx, src, dst)
 	})
 }
 
@@ -43,7 +43,16 @@ func sourceChanged(orig, now FileInfo) bool {
 	return false
 }
 
-func copyOnce(src, dst string) error {
+// sourceReplaced reports whether an append-only file was swapped or cut below
+// the limit captured earlier. Growth is expected and ignored.
+func sourceReplaced(orig, now FileInfo, limit int64) bool {
+	if now.Inode != 0 && orig.Inode != 0 && now.Inode != orig.Inode {
+		return true
+	}
+	return now.Size < limit
+}
+
+func copyOnce(ctx context.Context, src, dst string) error {
 	in, err := os.Open(src)
 	if err != nil {
 		return err
@@ -58,9 +67,22 @@ func copyOnce(src, dst string) error {
 		_ = out.Close()
 	}()
 
-	if _, err := io.Copy(out, in); err != nil {
+	if _, err := io.Copy(out, ctxReader{ctx: ctx, r: in}); err != nil {
 		return err
 	}
 
 	return out.Sync()
 }
+
+// ctxReader stops a long copy once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
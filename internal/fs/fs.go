@@ -4,6 +4,7 @@ package fs
 
 import (
 	"context"
+	"io"
 	"os"
 	"time"
 )
@@ -15,13 +16,70 @@ type FileInfo struct {
 	Inode uint64
 }
 
+// InodeOf returns the inode of a file listed by ReadDir, or 0 where the backend
+// has none. Hardlinks of one file share it.
+func InodeOf(info os.FileInfo) uint64 {
+	return inodeOf(info)
+}
+
+// ArchiveOptions tunes a single CreateCompressedTar call. Zero values fall back to Config.
+type ArchiveOptions struct {
+	Level int
+	Codec Codec    // nil selects DefaultCodec
+	Seal  Sealer   // encrypts the compressed stream; nil stores it as is
+	Extra []Member // in-memory members appended after the source files
+	// Limits lists source files that may grow while archived, such as an AOF
+	// being appended to. Only their first n bytes are stored.
+	Limits map[string]int64
+}
+
+// Sealer encrypts an archive after compression. Sealed archives carry
+// SealedExt after the codec extension.
+type Sealer interface {
+	Seal(w io.Writer) (io.WriteCloser, error)
+}
+
+// Member is a generated archive member, such as a manifest.
+type Member struct {
+	Name string
+	Data []byte
+}
+
+// SpaceReporter is implemented by filesystems that know their free space.
+type SpaceReporter interface {
+	// FreeSpace returns the bytes available for writing below path.
+	FreeSpace(path string) (int64, error)
+}
+
+// AtomicWriter is implemented by filesystems whose writes only become visible
+// once complete, such as object stores. Archives are written to their final
+// path there, as a rename would be a full copy followed by a delete.
+type AtomicWriter interface {
+	AtomicWrites() bool
+}
+
+// WritesAtomically reports whether f is an AtomicWriter with atomic writes.
+func WritesAtomically(f FS) bool {
+	aw, ok := f.(AtomicWriter)
+	return ok && aw.AtomicWrites()
+}
+
 type FS interface {
-	Stat(path string) (FileInfo, error)
+	Stat(ctx context.Context, path string) (FileInfo, error)
 	CopyFile(ctx context.Context, src, dst string) error
+	// LinkFile makes dst a copy of src sharing its storage where the backend
+	// can, and returns the method used: PinLink, PinReflink or PinCopy. Files
+	// made by it must be replaced, never written in place.
+	LinkFile(ctx context.Context, src, dst string) (string, error)
 	Rename(ctx context.Context, oldPath, newPath string) error
 	MkdirAll(path string) error
-	RemoveAll(path string) error
-	ReadDir(path string) ([]os.DirEntry, error)
+	RemoveAll(ctx context.Context, path string) error
+	ReadDir(ctx context.Context, path string) ([]os.DirEntry, error)
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	// WriteFile atomically replaces the file at path with data.
+	WriteFile(ctx context.Context, path string, data []byte) error
 	CopyDir(ctx context.Context, src, dst string) error
-	CreateCompressedTar(ctx context.Context, srcDir string, files []string, dst string) error
+	CreateCompressedTar(ctx context.Context, srcDir string, files []string, dst string, opts ArchiveOptions) (Checksums, error)
+	// Import copies a file from the local filesystem into this FS.
+	Import(ctx context.Context, localSrc, dst string) error
 }
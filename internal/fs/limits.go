@@ -0,0 +1,14 @@
+package fs
+
+import "sync"
+
+// ResourceLimits are the CPU and memory limits the process runs under.
+type ResourceLimits struct {
+	CPUs   float64 // 0 when unlimited
+	Memory int64   // bytes, 0 when unlimited
+}
+
+var detectLimits = sync.OnceValue(readCgroupLimits)
+
+// DetectLimits returns the cgroup limits of the process, read once.
+func DetectLimits() ResourceLimits { return detectLimits() }
@@ -0,0 +1,111 @@
+//go:build linux
+
+package fs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// readCgroupLimits reads the CPU quota and memory limit of the process from
+// cgroup v2, falling back to the v1 controllers.
+func readCgroupLimits() ResourceLimits {
+	if dir, ok := cgroupV2Dir(); ok {
+		return readCgroupV2(dir)
+	}
+	return readCgroupV1()
+}
+
+// cgroupV2Dir returns the unified hierarchy folder of the process.
+func cgroupV2Dir() (string, bool) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", false
+	}
+	if rel, ok := cgroupPaths()[""]; ok {
+		dir := filepath.Join(cgroupRoot, rel)
+		if _, err := os.Stat(filepath.Join(dir, "memory.max")); err == nil {
+			return dir, true
+		}
+	}
+	return cgroupRoot, true
+}
+
+// cgroupPaths maps each controller of /proc/self/cgroup to the cgroup of the
+// process; the unified hierarchy is listed under "".
+func cgroupPaths() map[string]string {
+	paths := make(map[string]string)
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return paths
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// hierarchy-ID:controller-list:path
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, ctrl := range strings.Split(parts[1], ",") {
+			paths[ctrl] = parts[2]
+		}
+	}
+	return paths
+}
+
+func readCgroupV2(dir string) ResourceLimits {
+	var lim ResourceLimits
+	// cpu.max: "<quota> <period>" or "max <period>"
+	if fields := strings.Fields(readCgroupFile(filepath.Join(dir, "cpu.max"))); len(fields) == 2 {
+		quota, err1 := strconv.ParseFloat(fields[0], 64)
+		period, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+			lim.CPUs = quota / period
+		}
+	}
+	if n, err := strconv.ParseInt(readCgroupFile(filepath.Join(dir, "memory.max")), 10, 64); err == nil && n > 0 {
+		lim.Memory = n
+	}
+	return lim
+}
+
+func readCgroupV1() ResourceLimits {
+	var lim ResourceLimits
+	paths := cgroupPaths()
+	quota, err1 := strconv.ParseFloat(readCgroupV1File(paths, "cpu", "cpu.cfs_quota_us"), 64)
+	period, err2 := strconv.ParseFloat(readCgroupV1File(paths, "cpu", "cpu.cfs_period_us"), 64)
+	if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+		lim.CPUs = quota / period
+	}
+	// Unlimited is reported as a huge page-aligned number.
+	if n, err := strconv.ParseInt(readCgroupV1File(paths, "memory", "memory.limit_in_bytes"), 10, 64); err == nil && n > 0 && n < 1<<62 {
+		lim.Memory = n
+	}
+	return lim
+}
+
+// readCgroupV1File reads name from the cgroup of the process in the controller
+// hierarchy, or from the hierarchy root when the cgroup is not visible, as
+// inside a container.
+func readCgroupV1File(paths map[string]string, ctrl, name string) string {
+	if rel, ok := paths[ctrl]; ok {
+		if v := readCgroupFile(filepath.Join(cgroupRoot, ctrl, rel, name)); v != "" {
+			return v
+		}
+	}
+	return readCgroupFile(filepath.Join(cgroupRoot, ctrl, name))
+}
+
+func readCgroupFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
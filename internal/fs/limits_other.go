@@ -0,0 +1,6 @@
+//go:build !linux
+
+package fs
+
+// readCgroupLimits reports no limits outside Linux.
+func readCgroupLimits() ResourceLimits { return ResourceLimits{} }
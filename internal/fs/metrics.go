@@ -0,0 +1,15 @@
+package fs
+
+import "github.com/raoulx24/rdb-archiver/internal/metrics"
+
+var retries = metrics.NewCounter(
+	"rdb_archiver_fs_retries_total",
+	"Filesystem operations retried after a transient error, by operation.",
+	"operation",
+)
+
+var retriesExhausted = metrics.NewCounter(
+	"rdb_archiver_fs_retries_exhausted_total",
+	"Filesystem operations that still failed after all retries, by operation.",
+	"operation",
+)
@@ -2,7 +2,10 @@ package fs
 
 import (
 	"context"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
@@ -18,7 +21,7 @@ func New(config Config) *OSFS {
 	return &OSFS{cfg: config}
 }
 
-func (o *OSFS) Stat(path string) (FileInfo, error) {
+func (o *OSFS) Stat(_ context.Context, path string) (FileInfo, error) {
 	st, err := os.Stat(path)
 	if err != nil {
 		return FileInfo{}, err
@@ -34,7 +37,7 @@ func (o *OSFS) Stat(path string) (FileInfo, error) {
 
 func (o *OSFS) MkdirAll(path string) error { return os.MkdirAll(path, 0o755) }
 
-func (o *OSFS) RemoveAll(path string) error {
+func (o *OSFS) RemoveAll(_ context.Context, path string) error {
 	return os.RemoveAll(path)
 }
 
@@ -45,6 +48,40 @@ func (o *OSFS) CopyFile(ctx context.Context, src, dst string) error {
 	return copyWithRetry(ctx, o, cfg, src, dst)
 }
 
+// LinkFile hardlinks src to dst, falling back to a reflink and then to a copy
+// across filesystems or where links are unsupported. The file is made next to
+// dst and renamed over it, so dst is never written through, as it may be a
+// link itself, and an interrupted copy leaves it untouched.
+func (o *OSFS) LinkFile(ctx context.Context, src, dst string) (string, error) {
+	tmp := filepath.Join(filepath.Dir(dst), ".tmp-"+filepath.Base(dst))
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	method, err := o.linkOrCopy(ctx, src, tmp)
+	if err == nil {
+		err = o.Rename(ctx, tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return method, nil
+}
+
+func (o *OSFS) linkOrCopy(ctx context.Context, src, dst string) (string, error) {
+	if err := os.Link(src, dst); err == nil {
+		return PinLink, nil
+	}
+	if err := reflink(src, dst); err == nil {
+		return PinReflink, nil
+	}
+	if err := o.CopyFile(ctx, src, dst); err != nil {
+		return "", err
+	}
+	return PinCopy, nil
+}
+
 func (o *OSFS) Rename(ctx context.Context, oldPath, newPath string) error {
 	o.mu.RLock()
 	cfg := o.cfg
@@ -52,7 +89,55 @@ func (o *OSFS) Rename(ctx context.Context, oldPath, newPath string) error {
 	return renameWithRetry(ctx, cfg, oldPath, newPath)
 }
 
-func (o *OSFS) ReadDir(path string) ([]os.DirEntry, error) { return os.ReadDir(path) }
+// FreeSpace reports the space left on the filesystem of path, or of its
+// nearest existing parent when path is not created yet.
+func (o *OSFS) FreeSpace(path string) (int64, error) {
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+	return freeSpace(path)
+}
+
+func (o *OSFS) ReadDir(_ context.Context, path string) ([]os.DirEntry, error) {
+	return os.ReadDir(path)
+}
+
+func (o *OSFS) Open(ctx context.Context, path string) (io.ReadCloser, error) { return os.Open(path) }
+
+// WriteFile writes data next to path and renames it into place. The file is
+// synced before the rename and its directory after, so that after a crash
+// path holds either the previous content or data.
+func (o *OSFS) WriteFile(ctx context.Context, path string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err := writeSynced(tmp, data); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := o.Rename(ctx, tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
 
 func (o *OSFS) CopyDir(ctx context.Context, src, dst string) error {
 	o.mu.RLock()
@@ -61,11 +146,18 @@ func (o *OSFS) CopyDir(ctx context.Context, src, dst string) error {
 	return copyDirWithRetry(ctx, o, cfg, src, dst)
 }
 
-func (o *OSFS) CreateCompressedTar(ctx context.Context, srcDir string, files []string, dst string) error {
+func (o *OSFS) CreateCompressedTar(ctx context.Context, srcDir string, files []string, dst string, opts ArchiveOptions) (Checksums, error) {
 	o.mu.RLock()
 	cfg := o.cfg
 	o.mu.RUnlock()
-	return createCompressedTarWithRetry(ctx, o, cfg, srcDir, files, dst)
+	return createCompressedTarWithRetry(ctx, o, cfg, srcDir, files, opts, func() (sink, error) {
+		return newFileSink(dst)
+	})
+}
+
+// Import is a plain copy for the local filesystem.
+func (o *OSFS) Import(ctx context.Context, localSrc, dst string) error {
+	return o.CopyFile(ctx, localSrc, dst)
 }
 
 func (o *OSFS) UpdateConfig(cfg Config) {
@@ -73,3 +165,10 @@ func (o *OSFS) UpdateConfig(cfg Config) {
 	o.cfg = cfg
 	o.mu.Unlock()
 }
+
+// config returns a copy of the current config. Remote backends use it for their retry settings.
+func (o *OSFS) config() Config {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.cfg
+}
@@ -0,0 +1,42 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(dst, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	o := New(Config{MaxRetries: 1, RetryBase: "1ms", RetryDurationCap: "1ms"})
+
+	// A failed link or copy leaves the existing file in place.
+	if _, err := o.LinkFile(context.Background(), src, dst); err == nil {
+		t.Fatal("LinkFile of a missing source succeeded")
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "old" {
+		t.Fatalf("dst = %q, %v; want it untouched", data, err)
+	}
+
+	if err := os.WriteFile(src, []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.LinkFile(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "new" {
+		t.Fatalf("dst = %q, %v; want the source", data, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d files in dir, want src and dst only", len(entries))
+	}
+}
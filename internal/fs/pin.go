@@ -0,0 +1,48 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Pin and LinkFile methods, in order of preference.
+const (
+	PinLink    = "hardlink"
+	PinReflink = "reflink"
+	PinCopy    = "copy"
+)
+
+// Pin makes a frozen view of src at dst and returns the method used. A hardlink
+// is frozen as long as the writer replaces src by rename, as Redis does for
+// dump.rdb; without allowLink only reflinks and full copies are tried. dst
+// keeps the mtime of src, and must be on the same filesystem for a link or
+// reflink to succeed.
+func (o *OSFS) Pin(src, dst string, allowLink bool) (string, error) {
+	if allowLink {
+		if err := os.Link(src, dst); err == nil {
+			return PinLink, nil
+		}
+	}
+
+	st, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+
+	method := PinReflink
+	err = reflink(src, dst)
+	if err != nil {
+		method = PinCopy
+		if err = copyOnce(context.Background(), src, dst); err != nil {
+			_ = os.Remove(dst)
+			return "", fmt.Errorf("pinning %s: %w", src, err)
+		}
+	}
+
+	if err := os.Chtimes(dst, st.ModTime(), st.ModTime()); err != nil {
+		_ = os.Remove(dst)
+		return "", fmt.Errorf("pinning %s: %w", src, err)
+	}
+	return method, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package fs
+
+import "errors"
+
+func reflink(src, dst string) error {
+	return errors.ErrUnsupported
+}
@@ -63,6 +63,8 @@ func retry(ctx context.Context, cfg Config, op Operation, fn func() error) error
 			break
 		}
 
+		retries.Inc(op.Name)
+
 		// Exponential backoff
 		sleep := base * (1 << (attempt - 1))
 
@@ -83,5 +85,6 @@ func retry(ctx context.Context, cfg Config, op Operation, fn func() error) error
 		}
 	}
 
+	retriesExhausted.Inc(op.Name)
 	return &RetryError{Op: op, Err: lastErr}
 }
@@ -0,0 +1,489 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3client.go is a minimal S3 API client (SigV4 signed) covering the calls the
+// archiver needs: object PUT/GET/HEAD/DELETE, server-side COPY, multipart upload
+// and ListObjectsV2. It works against AWS S3 and S3-compatible stores.
+
+const (
+	emptySHA256   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	maxCopyObject = 5 << 30 // larger objects must be copied with UploadPartCopy
+	maxParts      = 10000   // per multipart upload
+	maxPartSize   = 5 << 30
+	// partGrowth is the number of parts after which a stream of unknown
+	// length doubles its part size, reaching S3's 5 TiB object limit
+	// within maxParts.
+	partGrowth = 1000
+)
+
+// partSizeFor returns the part size, at least base, that uploads size bytes
+// within maxParts parts.
+func partSizeFor(base, size int64) int64 {
+	return min(max(base, (size+maxParts-1)/maxParts), maxPartSize)
+}
+
+type s3Client struct {
+	cfg  S3Config
+	base *url.URL
+	http *http.Client
+}
+
+// S3Error is an error response returned by the S3 API.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: http %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: http %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is lets errors.Is(err, os.ErrNotExist) match missing keys.
+func (e *S3Error) Is(target error) bool {
+	return target == os.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+// transient reports whether the request may succeed when retried.
+func (e *S3Error) transient() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.Code == "SlowDown"
+}
+
+// netError marks transport failures (resets, timeouts) as transient.
+type netError struct{ err error }
+
+func (e *netError) Error() string   { return e.err.Error() }
+func (e *netError) Unwrap() error   { return e.err }
+func (e *netError) transient() bool { return true }
+
+func newS3Client(cfg S3Config) (*s3Client, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing s3 endpoint: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	// Connection setup and response headers are bounded; bodies are not, as
+	// parts and objects take as long as the bandwidth requires.
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	tr.TLSHandshakeTimeout = 30 * time.Second
+	tr.ResponseHeaderTimeout = cfg.requestTimeout()
+	return &s3Client{cfg: cfg, base: u, http: &http.Client{Transport: tr}}, nil
+}
+
+// objectURL builds the request URL for key (empty key addresses the bucket).
+func (c *s3Client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.base
+	path := strings.TrimSuffix(u.Path, "/")
+	if c.cfg.PathStyle {
+		path += "/" + c.cfg.Bucket
+	} else {
+		u.Host = c.cfg.Bucket + "." + u.Host
+	}
+	path += "/" + key
+	u.Path = path
+	u.RawPath = escapePath(path)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do signs and sends a request. A non-2xx status is returned as *S3Error.
+func (c *s3Client) do(ctx context.Context, method, key string, query url.Values, hdr http.Header, body []byte) (*http.Response, error) {
+	u := c.objectURL(key, query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	c.sign(req, body, time.Now().UTC())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var ne net.Error
+		if errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil, &netError{err: err}
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		s3err := &S3Error{StatusCode: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		_ = xml.Unmarshal(data, s3err)
+		return nil, s3err
+	}
+	return resp, nil
+}
+
+// doDiscard performs a request and drops the response body.
+func (c *s3Client) doDiscard(ctx context.Context, method, key string, query url.Values, hdr http.Header, body []byte) (http.Header, error) {
+	resp, err := c.do(ctx, method, key, query, hdr, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Header, nil
+}
+
+// doResult performs a request whose 200 response may still report a failure
+// in an <Error> document, as copies and multipart completions do, and decodes
+// the result document into v.
+func (c *s3Client) doResult(ctx context.Context, method, key string, query url.Values, hdr http.Header, body []byte, v any) error {
+	resp, err := c.do(ctx, method, key, query, hdr, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &netError{err: err}
+	}
+	var s3err S3Error
+	if xml.Unmarshal(data, &s3err) == nil && s3err.Code != "" {
+		s3err.StatusCode = http.StatusInternalServerError
+		return &s3err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding result: %w", err)
+	}
+	return nil
+}
+
+// copyResult is the body of CopyObject and UploadPartCopy responses.
+type copyResult struct {
+	ETag string `xml:"ETag"`
+}
+
+// copyRequest sends a CopyObject or UploadPartCopy request and returns the
+// ETag of the copy. A response without one is not trusted as a copy.
+func (c *s3Client) copyRequest(ctx context.Context, dstKey string, query url.Values, hdr http.Header) (string, error) {
+	var res copyResult
+	if err := c.doResult(ctx, http.MethodPut, dstKey, query, hdr, nil, &res); err != nil {
+		return "", err
+	}
+	if res.ETag == "" {
+		return "", &S3Error{StatusCode: http.StatusInternalServerError, Code: "MissingETag", Message: "copy result has no ETag"}
+	}
+	return res.ETag, nil
+}
+
+func (c *s3Client) putObject(ctx context.Context, key string, body []byte) error {
+	_, err := c.doDiscard(ctx, http.MethodPut, key, nil, nil, body)
+	return err
+}
+
+// getObject returns the object body. The caller must close it.
+func (c *s3Client) getObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+type s3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+}
+
+func (c *s3Client) headObject(ctx context.Context, key string) (s3Object, error) {
+	h, err := c.doDiscard(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return s3Object{}, err
+	}
+	size, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	mod, _ := http.ParseTime(h.Get("Last-Modified"))
+	return s3Object{Key: key, Size: size, LastModified: mod, ETag: h.Get("ETag")}, nil
+}
+
+func (c *s3Client) deleteObject(ctx context.Context, key string) error {
+	_, err := c.doDiscard(ctx, http.MethodDelete, key, nil, nil, nil)
+	return err
+}
+
+// copyObject performs a server-side copy, using UploadPartCopy for objects above 5 GiB.
+func (c *s3Client) copyObject(ctx context.Context, srcKey, dstKey string, size int64) error {
+	source := "/" + c.cfg.Bucket + "/" + escapePath(srcKey)
+	if size <= maxCopyObject {
+		_, err := c.copyRequest(ctx, dstKey, nil, http.Header{"X-Amz-Copy-Source": {source}})
+		return err
+	}
+
+	uploadID, err := c.createMultipart(ctx, dstKey)
+	if err != nil {
+		return err
+	}
+
+	partSize := partSizeFor(c.cfg.partSize(), size)
+	var parts []completedPart
+	for off, n := int64(0), 1; off < size; off, n = off+partSize, n+1 {
+		end := min(off+partSize, size) - 1
+		q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		hdr := http.Header{
+			"X-Amz-Copy-Source":       {source},
+			"X-Amz-Copy-Source-Range": {fmt.Sprintf("bytes=%d-%d", off, end)},
+		}
+		etag, err := c.copyRequest(ctx, dstKey, q, hdr)
+		if err != nil {
+			c.abortMultipart(dstKey, uploadID)
+			return fmt.Errorf("copying part %d: %w", n, err)
+		}
+		parts = append(parts, completedPart{PartNumber: n, ETag: etag})
+	}
+
+	if err := c.completeMultipart(ctx, dstKey, uploadID, parts); err != nil {
+		c.abortMultipart(dstKey, uploadID)
+		return err
+	}
+	return nil
+}
+
+// listObjects lists keys under prefix. With a delimiter, common prefixes are
+// returned separately (they play the role of directories).
+func (c *s3Client) listObjects(ctx context.Context, prefix, delimiter string) ([]s3Object, []string, error) {
+	var (
+		objects  []s3Object
+		prefixes []string
+		token    string
+	)
+
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			q.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		resp, err := c.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var res struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+				ETag         string    `xml:"ETag"`
+			} `xml:"Contents"`
+			CommonPrefixes []struct {
+				Prefix string `xml:"Prefix"`
+			} `xml:"CommonPrefixes"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding list result: %w", err)
+		}
+
+		for _, o := range res.Contents {
+			objects = append(objects, s3Object{Key: o.Key, Size: o.Size, LastModified: o.LastModified, ETag: o.ETag})
+		}
+		for _, p := range res.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return objects, prefixes, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *s3Client) createMultipart(ctx context.Context, key string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("decoding multipart upload: %w", err)
+	}
+	return res.UploadID, nil
+}
+
+func (c *s3Client) uploadPart(ctx context.Context, key, uploadID string, n int, body []byte) (string, error) {
+	q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+	h, err := c.doDiscard(ctx, http.MethodPut, key, q, nil, body)
+	if err != nil {
+		return "", err
+	}
+	return h.Get("ETag"), nil
+}
+
+func (c *s3Client) completeMultipart(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	var res struct{}
+	return c.doResult(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body, &res)
+}
+
+// abortMultipart discards an unfinished upload. It is best-effort and uses its
+// own context so it also runs after cancellation.
+func (c *s3Client) abortMultipart(key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, _ = c.doDiscard(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+}
+
+// sign adds AWS Signature Version 4 headers to req.
+func (c *s3Client) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := emptySHA256
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	var names []string
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "host" || lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			names = append(names, lk)
+		}
+	}
+	sort.Strings(names)
+
+	var canonHeaders strings.Builder
+	for _, n := range names {
+		canonHeaders.WriteString(n + ":" + strings.TrimSpace(req.Header.Get(n)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.cfg.Region + "/s3/aws4_request"
+	reqHash := sha256.Sum256([]byte(canonReq))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(reqHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), day)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKeyID, scope, signedHeaders, sig,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath URI-encodes each path segment as SigV4 expects.
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = uriEncode(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// canonicalQuery encodes query parameters sorted by key, as SigV4 expects.
+func canonicalQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
@@ -0,0 +1,331 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3FS implements FS on top of an S3-compatible bucket. Paths are mapped to keys
+// by dropping the leading slash; "directories" are key prefixes ending in '/'.
+// Source files for archives are still read from the local filesystem.
+type S3FS struct {
+	cfg    S3Config
+	client *s3Client
+	local  *OSFS
+}
+
+// NewS3 creates an S3 backed FS. local provides retry settings and access to source files.
+func NewS3(cfg S3Config, local *OSFS) (*S3FS, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3: bucket is required")
+	}
+	client, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3FS{cfg: cfg, client: client, local: local}, nil
+}
+
+// Open returns the FS for a destination backend: "local" (default) or "s3".
+func Open(backend string, s3 S3Config, local *OSFS) (FS, error) {
+	switch backend {
+	case "", "local":
+		return local, nil
+	case "s3":
+		return NewS3(s3, local)
+	default:
+		return nil, fmt.Errorf("unknown destination backend %q", backend)
+	}
+}
+
+func toKey(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "/")
+}
+
+func (s *S3FS) Stat(ctx context.Context, path string) (FileInfo, error) {
+	var obj s3Object
+	err := retry(ctx, s.local.config(), Operation{Name: "s3-head"}, func() error {
+		var err error
+		obj, err = s.client.headObject(ctx, toKey(path))
+		return err
+	})
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Path: path, Size: obj.Size, MTime: obj.LastModified}, nil
+}
+
+// CopyFile performs a server-side copy between two keys of the bucket.
+func (s *S3FS) CopyFile(ctx context.Context, src, dst string) error {
+	st, err := s.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	return retry(ctx, s.local.config(), Operation{Name: "s3-copy"}, func() error {
+		return s.client.copyObject(ctx, toKey(src), toKey(dst), st.Size)
+	})
+}
+
+// LinkFile is a server-side copy: objects cannot share storage.
+func (s *S3FS) LinkFile(ctx context.Context, src, dst string) (string, error) {
+	if err := s.CopyFile(ctx, src, dst); err != nil {
+		return "", err
+	}
+	return PinCopy, nil
+}
+
+// Rename is a server-side copy followed by a delete; S3 has no atomic rename.
+func (s *S3FS) Rename(ctx context.Context, oldPath, newPath string) error {
+	if err := s.CopyFile(ctx, oldPath, newPath); err != nil {
+		return err
+	}
+	return retry(ctx, s.local.config(), Operation{Name: "s3-delete"}, func() error {
+		return s.client.deleteObject(ctx, toKey(oldPath))
+	})
+}
+
+// AtomicWrites reports true: a PUT or a completed multipart upload replaces the
+// object at once, and an aborted one leaves it untouched.
+func (s *S3FS) AtomicWrites() bool { return true }
+
+// MkdirAll is a no-op: prefixes exist implicitly.
+func (s *S3FS) MkdirAll(path string) error { return nil }
+
+// RemoveAll deletes the key at path and every key below it.
+func (s *S3FS) RemoveAll(ctx context.Context, path string) error {
+	cfg := s.local.config()
+	key := toKey(path)
+
+	objects, _, err := s.client.listObjects(ctx, key+"/", "")
+	if err != nil {
+		return err
+	}
+	keys := []string{key}
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+
+	for _, k := range keys {
+		err := retry(ctx, cfg, Operation{Name: "s3-delete"}, func() error {
+			return s.client.deleteObject(ctx, k)
+		})
+		if err != nil {
+			return fmt.Errorf("deleting %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// ReadDir lists the direct children of path, sorted by name like os.ReadDir.
+func (s *S3FS) ReadDir(ctx context.Context, path string) ([]os.DirEntry, error) {
+	prefix := toKey(path) + "/"
+	if prefix == "./" || prefix == "/" {
+		prefix = ""
+	}
+
+	objects, prefixes, err := s.client.listObjects(ctx, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]os.DirEntry, 0, len(objects)+len(prefixes))
+	for _, o := range objects {
+		name := strings.TrimPrefix(o.Key, prefix)
+		if name == "" {
+			continue
+		}
+		out = append(out, s3Entry{name: name, size: o.Size, mtime: o.LastModified})
+	}
+	for _, p := range prefixes {
+		name := strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/")
+		out = append(out, s3Entry{name: name, dir: true})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// Open streams the object at path. ctx also bounds reading the body.
+func (s *S3FS) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := retry(ctx, s.local.config(), Operation{Name: "s3-get"}, func() error {
+		var err error
+		body, err = s.client.getObject(ctx, toKey(path))
+		return err
+	})
+	return body, err
+}
+
+// WriteFile uploads data with a single PUT; object writes are atomic.
+func (s *S3FS) WriteFile(ctx context.Context, path string, data []byte) error {
+	return retry(ctx, s.local.config(), Operation{Name: "s3-put"}, func() error {
+		return s.client.putObject(ctx, toKey(path), data)
+	})
+}
+
+// CopyDir copies every key below src to the same relative key below dst.
+func (s *S3FS) CopyDir(ctx context.Context, src, dst string) error {
+	prefix := toKey(src) + "/"
+	objects, _, err := s.client.listObjects(ctx, prefix, "")
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		rel := strings.TrimPrefix(o.Key, prefix)
+		to := toKey(dst) + "/" + rel
+		err := retry(ctx, s.local.config(), Operation{Name: "s3-copy"}, func() error {
+			return s.client.copyObject(ctx, o.Key, to, o.Size)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateCompressedTar streams the archive straight into the bucket using multipart upload.
+func (s *S3FS) CreateCompressedTar(ctx context.Context, srcDir string, files []string, dst string, opts ArchiveOptions) (Checksums, error) {
+	cfg := s.local.config()
+	return createCompressedTarWithRetry(ctx, s.local, cfg, srcDir, files, opts, func() (sink, error) {
+		return s.newSink(ctx, cfg, dst), nil
+	})
+}
+
+// Import uploads a local file, restarting the upload from scratch on transient failures.
+func (s *S3FS) Import(ctx context.Context, localSrc, dst string) error {
+	cfg := s.local.config()
+	return retry(ctx, cfg, Operation{Name: "s3-import"}, func() error {
+		in, err := os.Open(localSrc)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out := s.newSink(ctx, cfg, dst)
+		if st, err := in.Stat(); err == nil {
+			out.partSize = partSizeFor(out.partSize, st.Size())
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Abort()
+			return err
+		}
+		return out.Commit()
+	})
+}
+
+func (s *S3FS) newSink(ctx context.Context, cfg Config, dst string) *s3Sink {
+	return &s3Sink{ctx: ctx, fsCfg: cfg, client: s.client, key: toKey(dst), partSize: s.cfg.partSize()}
+}
+
+// s3Sink buffers archive bytes into parts. Small archives are sent with a single
+// PUT; anything above one part switches to multipart upload. The length of a
+// compressed stream is unknown upfront, so the part size doubles every
+// partGrowth parts, and with it the memory buffered.
+type s3Sink struct {
+	ctx      context.Context
+	fsCfg    Config
+	client   *s3Client
+	key      string
+	partSize int64
+	buf      bytes.Buffer
+	uploadID string
+	parts    []completedPart
+}
+
+func (s *s3Sink) Write(p []byte) (int, error) {
+	n, _ := s.buf.Write(p)
+	for int64(s.buf.Len()) >= s.partSize {
+		if err := s.flushPart(s.buf.Next(int(s.partSize))); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (s *s3Sink) flushPart(data []byte) error {
+	if s.uploadID == "" {
+		id, err := s.client.createMultipart(s.ctx, s.key)
+		if err != nil {
+			return err
+		}
+		s.uploadID = id
+	}
+
+	part := completedPart{PartNumber: len(s.parts) + 1}
+	err := retry(s.ctx, s.fsCfg, Operation{Name: "s3-upload-part"}, func() error {
+		etag, err := s.client.uploadPart(s.ctx, s.key, s.uploadID, part.PartNumber, data)
+		part.ETag = etag
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.parts = append(s.parts, part)
+	if len(s.parts)%partGrowth == 0 {
+		s.partSize = min(2*s.partSize, maxPartSize)
+	}
+	return nil
+}
+
+func (s *s3Sink) Commit() error {
+	if s.uploadID == "" {
+		return retry(s.ctx, s.fsCfg, Operation{Name: "s3-put"}, func() error {
+			return s.client.putObject(s.ctx, s.key, s.buf.Bytes())
+		})
+	}
+
+	if s.buf.Len() > 0 {
+		if err := s.flushPart(s.buf.Bytes()); err != nil {
+			s.Abort()
+			return err
+		}
+	}
+	if err := s.client.completeMultipart(s.ctx, s.key, s.uploadID, s.parts); err != nil {
+		s.Abort()
+		return err
+	}
+	return nil
+}
+
+func (s *s3Sink) Abort() {
+	if s.uploadID != "" {
+		s.client.abortMultipart(s.key, s.uploadID)
+		s.uploadID = ""
+	}
+}
+
+// s3Entry adapts a listed key or prefix to os.DirEntry and os.FileInfo.
+type s3Entry struct {
+	name  string
+	size  int64
+	mtime time.Time
+	dir   bool
+}
+
+func (e s3Entry) Name() string               { return e.name }
+func (e s3Entry) IsDir() bool                { return e.dir }
+func (e s3Entry) Info() (os.FileInfo, error) { return e, nil }
+func (e s3Entry) Size() int64                { return e.size }
+func (e s3Entry) ModTime() time.Time         { return e.mtime }
+func (e s3Entry) Sys() any                   { return nil }
+
+func (e s3Entry) Type() os.FileMode {
+	if e.dir {
+		return os.ModeDir
+	}
+	return 0
+}
+
+func (e s3Entry) Mode() os.FileMode {
+	if e.dir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package fs
+
+import "errors"
+
+func freeSpace(path string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
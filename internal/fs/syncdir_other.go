@@ -0,0 +1,8 @@
+//go:build !unix
+
+package fs
+
+// syncDir is a no-op: directories cannot be synced on this platform.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,235 @@
+package fs
+
+import (
+	"io"
+	"runtime"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultZstdWindow = 8 << 20 // the encoder's own streaming default
+	minZstdWindow     = 1 << 20
+	minZstdChunk      = 4 << 20
+)
+
+// ZstdConfig tunes the zstd encoder for large snapshots. Zero values are
+// derived from GOMAXPROCS and the cgroup limits of the process.
+type ZstdConfig struct {
+	// Concurrency is the number of frames compressed in parallel; 1 keeps a
+	// single stream. 0 uses GOMAXPROCS, capped by the cgroup CPU quota.
+	Concurrency int `yaml:"concurrency"`
+	// WindowSizeMB is the match window; rounded down to a power of two.
+	WindowSizeMB int `yaml:"windowSizeMB"`
+	// MemoryBudgetMB bounds the estimated encoder memory. 0 uses a quarter of
+	// the cgroup memory limit, and no bound without one.
+	MemoryBudgetMB int `yaml:"memoryBudgetMB"`
+}
+
+// EncoderOptions are the effective settings of one archive encoder.
+type EncoderOptions struct {
+	Level       int
+	Concurrency int   // zstd only; frames compressed in parallel
+	WindowSize  int   // zstd only; bytes
+	Budget      int64 // bytes the settings were fitted into, 0 if unbounded
+}
+
+// EncoderOptions resolves the zstd settings for level against the detected
+// resource limits. Concurrency is given up before the window, so the ratio
+// stays as configured as long as a single stream fits.
+func (c ZstdConfig) EncoderOptions(level int) EncoderOptions {
+	lim := DetectLimits()
+
+	conc := c.Concurrency
+	if conc <= 0 {
+		conc = runtime.GOMAXPROCS(0)
+		if lim.CPUs > 0 {
+			conc = min(conc, max(1, int(lim.CPUs+0.5)))
+		}
+	}
+
+	window := int64(c.WindowSizeMB) << 20
+	if window <= 0 {
+		window = defaultZstdWindow
+	}
+	window = floorPow2(min(window, zstd.MaxWindowSize))
+
+	budget := int64(c.MemoryBudgetMB) << 20
+	if budget <= 0 && lim.Memory > 0 {
+		budget = lim.Memory / 4
+	}
+	if budget > 0 {
+		for conc > 1 && zstdMemory(level, conc, window) > budget {
+			conc--
+		}
+		for window > minZstdWindow && zstdMemory(level, conc, window) > budget {
+			window /= 2
+		}
+	}
+
+	return EncoderOptions{Level: level, Concurrency: conc, WindowSize: int(window), Budget: budget}
+}
+
+// zstdMemory estimates the encoder memory in bytes. A stream keeps about two
+// windows of history plus the match tables of its level; every parallel
+// frame adds its input chunk and a worst-case output buffer.
+func zstdMemory(level, conc int, window int64) int64 {
+	state := 2*window + zstdTables(level)
+	if conc <= 1 {
+		return state
+	}
+	chunk := zstdChunk(window)
+	return int64(conc)*(state+2*chunk) + chunk
+}
+
+// zstdTables approximates the match table size of a level, as measured with
+// the klauspost encoder.
+func zstdTables(level int) int64 {
+	switch zstd.EncoderLevelFromZstd(level) {
+	case zstd.SpeedFastest, zstd.SpeedDefault:
+		return 1 << 20
+	case zstd.SpeedBetterCompression:
+		return 4 << 20
+	default:
+		return 34 << 20
+	}
+}
+
+// zstdChunk is the input size of one parallel frame. Several windows per
+// frame keep the ratio loss at frame boundaries small.
+func zstdChunk(window int64) int64 {
+	return max(4*window, minZstdChunk)
+}
+
+func floorPow2(n int64) int64 {
+	p := int64(1)
+	for p*2 <= n {
+		p *= 2
+	}
+	return p
+}
+
+func newZstdWriter(w io.Writer, opts EncoderOptions) (io.WriteCloser, error) {
+	level := opts.Level
+	if level <= 0 {
+		level = 2
+	}
+	zopts := []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level))}
+	if opts.WindowSize > 0 {
+		zopts = append(zopts, zstd.WithWindowSize(opts.WindowSize))
+	}
+	if opts.Concurrency <= 1 {
+		return zstd.NewWriter(w, append(zopts, zstd.WithEncoderConcurrency(1))...)
+	}
+
+	window := int64(opts.WindowSize)
+	if window <= 0 {
+		window = defaultZstdWindow
+	}
+	p := &zstdParallelWriter{
+		w:     w,
+		chunk: int(zstdChunk(window)),
+		encs:  make(chan *zstd.Encoder, opts.Concurrency),
+		free:  make(chan []byte, opts.Concurrency+1),
+	}
+	for range opts.Concurrency {
+		enc, err := zstd.NewWriter(nil, append(zopts, zstd.WithEncoderConcurrency(1))...)
+		if err != nil {
+			return nil, err
+		}
+		p.encs <- enc
+	}
+	p.buf = p.buffer()
+	return p, nil
+}
+
+// zstdParallelWriter splits the stream into chunks and compresses each one as
+// an independent zstd frame on its own goroutine. Frames are written in order;
+// decoders read the concatenation as a single stream. At most cap(encs)
+// chunks are in flight, which bounds memory.
+type zstdParallelWriter struct {
+	w     io.Writer
+	chunk int
+	encs  chan *zstd.Encoder
+	free  chan []byte
+	buf   []byte
+	queue []*zstdFrame
+	err   error
+}
+
+type zstdFrame struct {
+	done chan struct{}
+	out  []byte
+}
+
+func (p *zstdParallelWriter) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 && p.err == nil {
+		k := min(len(b), p.chunk-len(p.buf))
+		p.buf = append(p.buf, b[:k]...)
+		b, n = b[k:], n+k
+		if len(p.buf) == p.chunk {
+			p.submit()
+		}
+	}
+	return n, p.err
+}
+
+func (p *zstdParallelWriter) submit() {
+	if len(p.queue) == cap(p.encs) {
+		p.flushOne()
+	}
+	in := p.buf
+	p.buf = p.buffer()
+
+	f := &zstdFrame{done: make(chan struct{})}
+	p.queue = append(p.queue, f)
+	enc := <-p.encs
+	go func() {
+		f.out = enc.EncodeAll(in, make([]byte, 0, len(in)/2))
+		p.encs <- enc
+		select {
+		case p.free <- in[:0]:
+		default:
+		}
+		close(f.done)
+	}()
+}
+
+// flushOne waits for the oldest frame and writes it out.
+func (p *zstdParallelWriter) flushOne() {
+	f := p.queue[0]
+	p.queue = p.queue[1:]
+	<-f.done
+	if p.err == nil {
+		_, p.err = p.w.Write(f.out)
+	}
+}
+
+func (p *zstdParallelWriter) buffer() []byte {
+	select {
+	case b := <-p.free:
+		return b
+	default:
+		return make([]byte, 0, p.chunk)
+	}
+}
+
+// Close compresses the remaining input, writes every pending frame and
+// releases the encoders. It is safe to call more than once.
+func (p *zstdParallelWriter) Close() error {
+	if p.encs == nil {
+		return p.err
+	}
+	if len(p.buf) > 0 && p.err == nil {
+		p.submit()
+	}
+	for len(p.queue) > 0 {
+		p.flushOne()
+	}
+	for range cap(p.encs) {
+		_ = (<-p.encs).Close()
+	}
+	p.encs, p.buf = nil, nil
+	return p.err
+}
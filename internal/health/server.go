@@ -2,23 +2,30 @@
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/raoulx24/rdb-archiver/internal/catalog"
+	"github.com/raoulx24/rdb-archiver/internal/metrics"
+	"github.com/raoulx24/rdb-archiver/internal/scrub"
 	"github.com/raoulx24/rdb-archiver/internal/snapshotwatcher"
+	"github.com/raoulx24/rdb-archiver/internal/worker"
 )
 
 type Server struct {
 	cfg     Config
 	watcher *snapshotwatcher.Watcher
+	worker  *worker.Worker
+	scrub   *scrub.Scrubber
 	srv     *http.Server
 	mu      sync.RWMutex
 }
 
-func New(config Config, watcher *snapshotwatcher.Watcher) *Server {
-	return &Server{cfg: config, watcher: watcher}
+func New(config Config, watcher *snapshotwatcher.Watcher, w *worker.Worker, scrubber *scrub.Scrubber) *Server {
+	return &Server{cfg: config, watcher: watcher, worker: w, scrub: scrubber}
 }
 
 func (s *Server) Start(ctx context.Context) error {
@@ -29,6 +36,9 @@ func (s *Server) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ready", s.ready)
 	mux.HandleFunc("/live", s.live)
+	mux.HandleFunc("/status", s.status)
+	mux.HandleFunc("/snapshots", s.snapshots)
+	mux.HandleFunc("/metrics", s.metrics)
 
 	s.srv = &http.Server{Addr: addr, Handler: mux}
 
@@ -58,3 +68,45 @@ func (s *Server) live(w http.ResponseWriter, r *http.Request) {
 	}
 	http.Error(w, "watcher not alive", http.StatusServiceUnavailable)
 }
+
+// status reports the per-target archive status, the worker queue, the latest
+// reconcile sweep and the scrubber progress as JSON.
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	wk, sc := s.worker, s.scrub
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Targets   []worker.TargetStatus  `json:"targets"`
+		Queue     worker.QueueStatus     `json:"queue"`
+		Reconcile worker.ReconcileStatus `json:"reconcile"`
+		Scrub     scrub.Status           `json:"scrub"`
+	}{Targets: wk.Status(), Queue: wk.Queue(), Reconcile: wk.Reconciled(), Scrub: sc.Status()})
+}
+
+// snapshots lists archived snapshots with their manifests as JSON.
+// Query parameters target and rule narrow the listing.
+func (s *Server) snapshots(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	wk := s.worker
+	s.mu.RUnlock()
+
+	q := r.URL.Query()
+	entries, err := wk.Snapshots(r.Context(), q.Get("target"), q.Get("rule"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Snapshots []catalog.Entry `json:"snapshots"`
+	}{Snapshots: entries})
+}
+
+// metrics exposes all registered metrics in the Prometheus text format.
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	_ = metrics.WriteText(w)
+}
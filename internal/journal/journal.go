@@ -0,0 +1,158 @@
+// Package journal records how far the snapshot being archived got in a small
+// file under each destination root. After a crash the worker reads it back to
+// remove partial archives and finish the retention of committed ones.
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+// FileName is the journal file in the destination root. The leading dot keeps
+// it out of catalog listings.
+const FileName = ".journal.json"
+
+// State is the progress of the journaled snapshot.
+type State string
+
+const (
+	Detected   State = "detected"    // taken by the worker, nothing written yet
+	InProgress State = "in-progress" // the files in Record.Partial are being written
+	Committed  State = "committed"   // archive and sidecar are in place
+	Promoted   State = "promoted"    // retention was applied
+	Failed     State = "failed"      // archiving failed; partial files were removed
+)
+
+// Record is the state of the latest snapshot handled for one destination.
+type Record struct {
+	Snapshot string    `json:"snapshot"` // archive timestamp
+	Source   string    `json:"source"`   // primary file the archive is made of
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	State    State     `json:"state"`
+	// Partial lists the temporary files written while in progress; Staging
+	// those in the local staging dir, when the archive is built there.
+	Partial []string  `json:"partial,omitempty"`
+	Staging []string  `json:"staging,omitempty"`
+	Archive string    `json:"archive,omitempty"` // final archive once committed
+	Updated time.Time `json:"updated"`
+}
+
+// NewRecord returns the record of a detected snapshot.
+func NewRecord(ts string, primary snapshot.Artifact) Record {
+	return Record{Snapshot: ts, Source: primary.Name, Size: primary.Size, ModTime: primary.ModTime.UTC(), State: Detected}
+}
+
+// Same reports whether r journals the snapshot ts made of primary.
+func (r *Record) Same(ts string, primary snapshot.Artifact) bool {
+	return r != nil && r.Snapshot == ts && r.Source == primary.Name &&
+		r.Size == primary.Size && r.ModTime.Equal(primary.ModTime)
+}
+
+// Done reports whether the archive was committed.
+func (r *Record) Done() bool {
+	return r != nil && (r.State == Committed || r.State == Promoted)
+}
+
+// Journal reads and writes the journal of one destination root.
+type Journal struct {
+	fs   fs.FS
+	path string
+
+	mu     sync.Mutex
+	loaded bool
+	last   *Record
+}
+
+// New returns the journal stored in root.
+func New(filesystem fs.FS, root string) *Journal {
+	return &Journal{fs: filesystem, path: filepath.Join(root, FileName)}
+}
+
+// Path returns the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Last returns the latest record, reading the journal file on first use. It
+// returns nil when nothing was journaled yet.
+func (j *Journal) Last(ctx context.Context) (*Record, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.loaded {
+		return j.last, nil
+	}
+
+	in, err := j.fs.Open(ctx, j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		j.loaded = true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", j.path, err)
+	}
+	j.last, j.loaded = &rec, true
+	return j.last, nil
+}
+
+// Write stores rec as the latest record. The write is atomic, and durable once
+// Write returns: see fs.OSFS.WriteFile.
+func (j *Journal) Write(ctx context.Context, rec Record) error {
+	rec.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.fs.MkdirAll(filepath.Dir(j.path)); err != nil {
+		return err
+	}
+	if err := j.fs.WriteFile(ctx, j.path, data); err != nil {
+		return err
+	}
+	j.last, j.loaded = &rec, true
+	return nil
+}
+
+// Advance moves the latest record to state, optionally recording the archive.
+// It does nothing when nothing was journaled.
+func (j *Journal) Advance(ctx context.Context, state State, archive string) error {
+	j.mu.Lock()
+	last := j.last
+	j.mu.Unlock()
+	if last == nil {
+		return nil
+	}
+
+	rec := *last
+	rec.State = state
+	if archive != "" {
+		rec.Archive = archive
+	}
+	if state != InProgress {
+		rec.Partial, rec.Staging = nil, nil
+	}
+	return j.Write(ctx, rec)
+}
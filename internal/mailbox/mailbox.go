@@ -8,15 +8,19 @@ import (
 // Mailbox is a single-slot buffer where the latest job always wins.
 // It is NOT a queue. It holds at most one pending job.
 // Put() overwrites any existing job. Take() blocks until a job is available.
+// Overwritten jobs are counted, and Arrived lets the consumer notice a newer
+// job while it is still busy with the previous one.
 type Mailbox[T any] struct {
-	mu   sync.Mutex
-	cond *sync.Cond
-	job  *T
+	mu      sync.Mutex
+	cond    *sync.Cond
+	job     *T
+	dropped uint64
+	arrived chan struct{}
 }
 
 // New creates an empty mailbox.
 func New[T any]() *Mailbox[T] {
-	m := &Mailbox[T]{}
+	m := &Mailbox[T]{arrived: make(chan struct{}, 1)}
 	m.cond = sync.NewCond(&m.mu)
 	return m
 }
@@ -25,14 +29,51 @@ func New[T any]() *Mailbox[T] {
 // It never blocks.
 func (m *Mailbox[T]) Put(j T) {
 	m.mu.Lock()
+	if m.job != nil {
+		m.dropped++
+		overwrites.Inc()
+	}
 	m.job = &j
+	select {
+	case m.arrived <- struct{}{}:
+	default:
+	}
 	m.cond.Signal() // wake up worker if waiting
 	m.mu.Unlock()
 }
 
+// Arrived is signalled when a job is put and not yet taken. Taking the job
+// clears the signal.
+func (m *Mailbox[T]) Arrived() <-chan struct{} {
+	return m.arrived
+}
+
+// Dropped returns how many jobs were overwritten before being taken.
+func (m *Mailbox[T]) Dropped() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dropped
+}
+
+// clearArrived drops a pending arrival signal; m.mu must be held.
+func (m *Mailbox[T]) clearArrived() {
+	select {
+	case <-m.arrived:
+	default:
+	}
+}
+
 // Take blocks until a job is available, then returns it and clears the slot.
 func (m *Mailbox[T]) Take(ctx context.Context) (T, bool) {
 	var zero T
+	// Wake the wait below when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		m.mu.Lock()
+		m.cond.Broadcast()
+		m.mu.Unlock()
+	})
+	defer stop()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -46,6 +87,7 @@ func (m *Mailbox[T]) Take(ctx context.Context) (T, bool) {
 
 	j := *m.job
 	m.job = nil
+	m.clearArrived()
 	return j, true
 }
 
@@ -61,6 +103,7 @@ func (m *Mailbox[T]) TryTake() *T {
 
 	j := m.job
 	m.job = nil
+	m.clearArrived()
 	return j
 }
 
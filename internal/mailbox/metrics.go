@@ -0,0 +1,8 @@
+package mailbox
+
+import "github.com/raoulx24/rdb-archiver/internal/metrics"
+
+var overwrites = metrics.NewCounter(
+	"rdb_archiver_mailbox_overwrites_total",
+	"Pending jobs replaced by a newer one before the worker took them.",
+)
@@ -0,0 +1,102 @@
+// Package manifest describes the content of an archived snapshot. A manifest is
+// stored inside every archive as manifest.json and next to it as a sidecar, so
+// snapshots can be audited without being restored.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/aof"
+	"github.com/raoulx24/rdb-archiver/internal/cluster"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/rdb"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+const (
+	// FileName is the name of the manifest member inside an archive.
+	FileName = "manifest.json"
+	// SidecarSuffix replaces the archive extension for the sidecar file.
+	SidecarSuffix = ".manifest.json"
+
+	// schemaVersion is bumped on incompatible changes of the JSON layout.
+	schemaVersion = 1
+)
+
+// Manifest is the self-description of one archive.
+type Manifest struct {
+	Version         int               `json:"version"`
+	Snapshot        string            `json:"snapshot"`        // archive name without extension
+	TimestampSource string            `json:"timestampSource"` // what Snapshot was derived from: mtime, ctime or detected
+	CreatedAt       time.Time         `json:"createdAt"`
+	Mode            string            `json:"mode"` // "rdb" or "aof"
+	Files           []File            `json:"files"`
+	AOF             *aof.Manifest     `json:"aof,omitempty"`
+	RDB             *RDB              `json:"rdb,omitempty"`
+	Cluster         *Cluster          `json:"cluster,omitempty"`
+	Capture         *snapshot.Capture `json:"capture,omitempty"`
+	// Checksums of the archive and its members; only in the sidecar, as they
+	// are known once the archive is written.
+	Checksums *fs.Checksums `json:"checksums,omitempty"`
+}
+
+// Cluster is the topology read from the snapshot's nodes.conf.
+type Cluster struct {
+	File string `json:"file"` // aux file it was parsed from
+	cluster.Topology
+}
+
+// File is one source file stored in the archive.
+type File struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// RDB holds the header, checksum and aux metadata of the primary RDB file.
+type RDB struct {
+	Magic    string `json:"magic"`
+	Version  int    `json:"version"`
+	Checksum string `json:"checksum,omitempty"` // CRC64 trailer, hex
+	Verified bool   `json:"verified"`
+	rdb.Metadata
+}
+
+// New returns an empty manifest; the snapshot name is set once it is known.
+func New() *Manifest {
+	return &Manifest{Version: schemaVersion, CreatedAt: time.Now().UTC()}
+}
+
+// SetRDB records the outcome of rdb.Inspect. meta may be nil.
+func (m *Manifest) SetRDB(res rdb.Result, meta *rdb.Metadata) {
+	r := &RDB{Magic: res.Magic, Version: res.Version, Verified: res.Verified}
+	if res.Checksum != 0 {
+		r.Checksum = fmt.Sprintf("%016x", res.Checksum)
+	}
+	if meta != nil {
+		r.Metadata = *meta
+	}
+	m.RDB = r
+}
+
+// Marshal encodes the manifest as indented JSON.
+func (m *Manifest) Marshal() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// Parse decodes a manifest.
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// SidecarPath returns the sidecar location for an archive path.
+func SidecarPath(archive string) string {
+	base, _ := fs.TrimArchiveExt(archive)
+	return base + SidecarSuffix
+}
@@ -0,0 +1,130 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// SignatureSuffix is appended to the sidecar path for its detached signature.
+const SignatureSuffix = ".sig"
+
+// ErrBadSignature is returned when a sidecar does not match its signature.
+var ErrBadSignature = errors.New("manifest signature mismatch")
+
+// Signature is the detached ed25519 signature of a sidecar's exact bytes.
+type Signature struct {
+	Algorithm string `json:"algorithm"` // "ed25519"
+	KeyID     string `json:"keyId"`     // see KeyID
+	Signature []byte `json:"signature"`
+}
+
+// SignaturePath returns the signature location for an archive path.
+func SignaturePath(archive string) string {
+	return SidecarPath(archive) + SignatureSuffix
+}
+
+// KeyID identifies a public key by the first 8 bytes of its SHA-256, in hex.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Signer signs sidecars with an ed25519 private key.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// LoadSigner reads a PEM encoded PKCS #8 ed25519 private key, as written by
+// "openssl genpkey -algorithm ed25519".
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Signer{key: key}, nil
+}
+
+// Public returns the verification key.
+func (s *Signer) Public() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign returns the encoded signature file for sidecar data.
+func (s *Signer) Sign(data []byte) ([]byte, error) {
+	sig := Signature{Algorithm: "ed25519", KeyID: KeyID(s.Public()), Signature: ed25519.Sign(s.key, data)}
+	return json.MarshalIndent(sig, "", "  ")
+}
+
+// Verify checks the signature file sigData against the sidecar data.
+func Verify(pub ed25519.PublicKey, data, sigData []byte) error {
+	var sig Signature
+	if err := json.Unmarshal(sigData, &sig); err != nil {
+		return fmt.Errorf("parsing signature: %w", err)
+	}
+	if sig.Algorithm != "ed25519" {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	if id := KeyID(pub); sig.KeyID != id {
+		return fmt.Errorf("%w: signed with key %s, verifying with %s", ErrBadSignature, sig.KeyID, id)
+	}
+	if !ed25519.Verify(pub, data, sig.Signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// LoadPublicKey reads an ed25519 public key from a PEM "PUBLIC KEY" block, or
+// derives it from a private key file.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	if block.Type != "PUBLIC KEY" {
+		key, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", path)
+	}
+	return key, nil
+}
+
+func parsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PEM \"PRIVATE KEY\" block")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ed25519 key")
+	}
+	return priv, nil
+}
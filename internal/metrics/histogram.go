@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Histogram counts observations into cumulative buckets, optionally split by
+// labels.
+type Histogram struct {
+	desc
+	buckets []float64 // upper bounds, ascending; +Inf is implicit
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates and registers a histogram with the given bucket upper
+// bounds.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h := &Histogram{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: b,
+		series:  map[string]*histogramSeries{},
+	}
+	register(h)
+	return h
+}
+
+// ExponentialBuckets returns count bounds starting at start, each factor
+// times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	b := make([]float64, count)
+	for i := range b {
+		b[i] = start
+		start *= factor
+	}
+	return b
+}
+
+// Observe records v for the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := joinLabels(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v) // first bound >= v
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations for the given label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s := h.series[joinLabels(labelValues)]; s != nil {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) samples(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		values := labelValues(&h.desc, key)
+		var cum uint64
+		for i, n := range s.counts {
+			cum += n
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			writeSample(b, h.name+"_bucket", h.labels, values, "le", formatFloat(le), float64(cum))
+		}
+		writeSample(b, h.name+"_sum", h.labels, values, "", "", s.sum)
+		writeSample(b, h.name+"_count", h.labels, values, "", "", float64(s.count))
+	}
+}
@@ -0,0 +1,147 @@
+// Package metrics holds the process-wide counters, gauges and histograms
+// exported by rdb-archiver. Metrics are declared by the packages that update
+// them and registered here on creation; WriteText renders them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	regMu    sync.Mutex
+	registry = map[string]collector{}
+)
+
+// collector is a registered metric family.
+type collector interface {
+	describe() *desc
+	// samples appends one line per series, without HELP and TYPE.
+	samples(b *strings.Builder)
+}
+
+// desc is the identity shared by all metric types.
+type desc struct {
+	name   string
+	help   string
+	kind   string // counter | gauge | histogram
+	labels []string
+}
+
+func (d *desc) describe() *desc { return d }
+
+func register(c collector) {
+	regMu.Lock()
+	registry[c.describe().name] = c
+	regMu.Unlock()
+}
+
+// Counter is a monotonically increasing value, optionally split by labels.
+type Counter struct {
+	desc
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by joined label values
+}
+
+// NewCounter creates and registers a counter. Label values are passed, in the
+// same order as labels, to Inc and Add.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name: name, help: help, kind: "counter", labels: labels}, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter by v. Negative values are ignored.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := joinLabels(labelValues)
+
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the current value for the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[joinLabels(labelValues)]
+}
+
+func (c *Counter) samples(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeValues(b, &c.desc, c.values)
+}
+
+// Gauge is a value that can go up and down, optionally split by labels.
+type Gauge struct {
+	desc
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge creates and registers a gauge.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, values: map[string]float64{}}
+	register(g)
+	return g
+}
+
+// Set replaces the value for the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := joinLabels(labelValues)
+
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Add changes the value by v, which may be negative.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	key := joinLabels(labelValues)
+
+	g.mu.Lock()
+	g.values[key] += v
+	g.mu.Unlock()
+}
+
+// Delete drops the series for the given label values, e.g. for a removed rule.
+func (g *Gauge) Delete(labelValues ...string) {
+	key := joinLabels(labelValues)
+
+	g.mu.Lock()
+	delete(g.values, key)
+	g.mu.Unlock()
+}
+
+// Value returns the current value for the given label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[joinLabels(labelValues)]
+}
+
+func (g *Gauge) samples(b *strings.Builder) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeValues(b, &g.desc, g.values)
+}
+
+func joinLabels(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func splitLabels(key string) []string {
+	return strings.Split(key, "\xff")
+}
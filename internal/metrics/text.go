@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of WriteText output.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteText writes every registered metric to w in the Prometheus text
+// exposition format, sorted by name.
+func WriteText(w io.Writer) error {
+	regMu.Lock()
+	collectors := make([]collector, 0, len(registry))
+	for _, c := range registry {
+		collectors = append(collectors, c)
+	}
+	regMu.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].describe().name < collectors[j].describe().name })
+
+	var b strings.Builder
+	for _, c := range collectors {
+		d := c.describe()
+		b.WriteString("# HELP " + d.name + " " + escapeHelp(d.help) + "\n")
+		b.WriteString("# TYPE " + d.name + " " + d.kind + "\n")
+		c.samples(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeValues writes the series of a counter or gauge. Families without
+// labels always have a sample, so they read as zero before their first use.
+func writeValues(b *strings.Builder, d *desc, values map[string]float64) {
+	if len(d.labels) == 0 {
+		writeSample(b, d.name, nil, nil, "", "", values[""])
+		return
+	}
+	for _, key := range sortedKeys(values) {
+		writeSample(b, d.name, d.labels, labelValues(d, key), "", "", values[key])
+	}
+}
+
+// writeSample writes one line; extraName/extraValue add a label such as le.
+func writeSample(b *strings.Builder, name string, labels, values []string, extraName, extraValue string, v float64) {
+	b.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		b.WriteByte('{')
+		sep := ""
+		for i, l := range labels {
+			b.WriteString(sep + l + `="` + escapeValue(values[i]) + `"`)
+			sep = ","
+		}
+		if extraName != "" {
+			b.WriteString(sep + extraName + `="` + extraValue + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+}
+
+// labelValues splits key into one value per label of d; missing values are
+// empty.
+func labelValues(d *desc, key string) []string {
+	values := splitLabels(key)
+	if len(values) < len(d.labels) {
+		values = append(values, make([]string, len(d.labels)-len(values))...)
+	}
+	return values
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
@@ -0,0 +1,13 @@
+package rdb
+
+import "hash/crc64"
+
+// Redis uses CRC-64/Jones: reflected, polynomial 0xad93d23594c935a9, no init
+// or final xor. hash/crc64 implements the reflected algorithm but inverts the
+// register on entry and exit, which is undone here.
+var jonesTable = crc64.MakeTable(0x95ac9329ac4bc9b5) // bit-reversed 0xad93d23594c935a9
+
+// crcUpdate extends a Jones CRC with p.
+func crcUpdate(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, jonesTable, p)
+}
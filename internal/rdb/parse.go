@@ -0,0 +1,629 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Opcodes preceding the key/value entries of an RDB file.
+const (
+	opSlotInfo    = 0xF4
+	opFunction2   = 0xF5
+	opModuleAux   = 0xF7
+	opIdle        = 0xF8
+	opFreq        = 0xF9
+	opAux         = 0xFA
+	opResizeDB    = 0xFB
+	opExpireMS    = 0xFC
+	opExpire      = 0xFD
+	opSelectDB    = 0xFE
+	moduleOpEOF   = 0
+	moduleOpSInt  = 1
+	moduleOpUInt  = 2
+	moduleOpFloat = 3
+	moduleOpDbl   = 4
+	moduleOpStr   = 5
+)
+
+// errUnsupported stops the walk at a construct the parser cannot skip.
+var errUnsupported = errors.New("unsupported rdb construct")
+
+// Database summarizes one logical database of the RDB.
+type Database struct {
+	Index          int    `json:"index"`
+	ResizeKeys     uint64 `json:"resizeKeys"`    // RESIZEDB hint: keys at save time
+	ResizeExpires  uint64 `json:"resizeExpires"` // RESIZEDB hint: keys with a TTL
+	Keys           uint64 `json:"keys"`          // keys actually walked
+	KeysWithExpiry uint64 `json:"keysWithExpiry"`
+}
+
+// Metadata is what can be learned about a snapshot without loading it.
+type Metadata struct {
+	Aux          map[string]string `json:"aux"`
+	RedisVersion string            `json:"redisVersion,omitempty"`
+	CTime        time.Time         `json:"ctime,omitempty"`
+	UsedMem      int64             `json:"usedMem,omitempty"`
+	ReplID       string            `json:"replId,omitempty"`
+	ReplOffset   int64             `json:"replOffset,omitempty"`
+	AOFBase      bool              `json:"aofBase"`
+	Databases    []Database        `json:"databases"`
+	Complete     bool              `json:"complete"` // every entry was walked; Keys counts are exact
+	ParseError   string            `json:"parseError,omitempty"`
+}
+
+// KeyCount returns the number of keys, preferring walked counts when complete.
+func (m *Metadata) KeyCount() uint64 {
+	var n uint64
+	for _, db := range m.Databases {
+		if m.Complete {
+			n += db.Keys
+		} else {
+			n += db.ResizeKeys
+		}
+	}
+	return n
+}
+
+type parser struct {
+	r    *bufio.Reader
+	meta *Metadata
+	db   *Database
+}
+
+// parse walks the RDB body after the 9 byte header. It stops early, keeping
+// what it learned, when it meets a value encoding it cannot skip.
+func parse(r io.Reader) *Metadata {
+	br := bufio.NewReaderSize(r, 1<<20)
+	meta := &Metadata{Aux: map[string]string{}}
+
+	if _, err := br.Discard(9); err != nil {
+		meta.ParseError = err.Error()
+		return meta
+	}
+
+	p := &parser{r: br, meta: meta}
+	if err := p.walk(); err != nil {
+		meta.ParseError = err.Error()
+	} else {
+		meta.Complete = true
+	}
+	meta.fillWellKnown()
+	return meta
+}
+
+func (p *parser) walk() error {
+	expiring := false
+
+	for {
+		op, err := p.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case opEOF:
+			return nil
+
+		case opAux:
+			k, err := p.str()
+			if err != nil {
+				return err
+			}
+			v, err := p.str()
+			if err != nil {
+				return err
+			}
+			p.meta.Aux[string(k)] = string(v)
+
+		case opSelectDB:
+			n, err := p.length()
+			if err != nil {
+				return err
+			}
+			p.meta.Databases = append(p.meta.Databases, Database{Index: int(n)})
+			p.db = &p.meta.Databases[len(p.meta.Databases)-1]
+
+		case opResizeDB:
+			keys, err := p.length()
+			if err != nil {
+				return err
+			}
+			expires, err := p.length()
+			if err != nil {
+				return err
+			}
+			if p.db != nil {
+				p.db.ResizeKeys, p.db.ResizeExpires = keys, expires
+			}
+
+		case opSlotInfo:
+			for range 3 {
+				if _, err := p.length(); err != nil {
+					return err
+				}
+			}
+
+		case opFunction2:
+			if err := p.skipStr(); err != nil {
+				return err
+			}
+
+		case opModuleAux:
+			if err := p.skipModuleAux(); err != nil {
+				return err
+			}
+
+		case opExpire:
+			expiring = true
+			if err := p.skip(4); err != nil {
+				return err
+			}
+
+		case opExpireMS:
+			expiring = true
+			if err := p.skip(8); err != nil {
+				return err
+			}
+
+		case opFreq:
+			if err := p.skip(1); err != nil {
+				return err
+			}
+
+		case opIdle:
+			if _, err := p.length(); err != nil {
+				return err
+			}
+
+		default:
+			if op >= 0xF0 {
+				return fmt.Errorf("%w: opcode 0x%02x", errUnsupported, op)
+			}
+			if err := p.skipStr(); err != nil { // key
+				return err
+			}
+			if err := p.skipValue(op); err != nil {
+				return err
+			}
+			if p.db == nil {
+				p.meta.Databases = append(p.meta.Databases, Database{})
+				p.db = &p.meta.Databases[0]
+			}
+			p.db.Keys++
+			if expiring {
+				p.db.KeysWithExpiry++
+			}
+			expiring = false
+		}
+	}
+}
+
+// skipValue skips the value of the given type.
+func (p *parser) skipValue(t byte) error {
+	switch t {
+	case 0, 9, 10, 11, 12, 13, 16, 17, 20: // string and single-blob encodings (ziplist, intset, listpack)
+		return p.skipStr()
+
+	case 1, 2, 14: // list, set, quicklist
+		return p.repeat(1, p.skipStr)
+
+	case 3: // zset with ascii scores
+		return p.repeat(1, func() error {
+			if err := p.skipStr(); err != nil {
+				return err
+			}
+			return p.skipDoubleString()
+		})
+
+	case 4: // hash
+		return p.repeat(2, p.skipStr)
+
+	case 5: // zset with binary scores
+		return p.repeat(1, func() error {
+			if err := p.skipStr(); err != nil {
+				return err
+			}
+			return p.skip(8)
+		})
+
+	case 7: // module, v2 format
+		if _, err := p.length(); err != nil {
+			return err
+		}
+		return p.skipModuleOpcodes()
+
+	case 15, 19, 21: // streams
+		return p.skipStream(t)
+
+	case 18: // quicklist v2: container type + node blob
+		return p.repeat(1, func() error {
+			if _, err := p.length(); err != nil {
+				return err
+			}
+			return p.skipStr()
+		})
+
+	case 24: // hash with field TTLs: min expire, then ttl/field/value triples
+		if err := p.skip(8); err != nil {
+			return err
+		}
+		return p.repeat(1, func() error {
+			if _, err := p.length(); err != nil {
+				return err
+			}
+			if err := p.skipStr(); err != nil {
+				return err
+			}
+			return p.skipStr()
+		})
+
+	case 25: // listpack hash with field TTLs
+		if err := p.skip(8); err != nil {
+			return err
+		}
+		return p.skipStr()
+	}
+
+	return fmt.Errorf("%w: value type %d", errUnsupported, t)
+}
+
+func (p *parser) skipStream(t byte) error {
+	// listpack nodes: master id + listpack blob
+	if err := p.repeat(2, p.skipStr); err != nil {
+		return err
+	}
+
+	// length, last id; v2+ adds first id, max deleted id and entries added
+	fields := 3
+	if t >= 19 {
+		fields += 5
+	}
+	for range fields {
+		if _, err := p.length(); err != nil {
+			return err
+		}
+	}
+
+	return p.repeat(1, func() error { // consumer groups
+		if err := p.skipStr(); err != nil {
+			return err
+		}
+		ids := 2 // last delivered id
+		if t >= 19 {
+			ids++ // entries read
+		}
+		for range ids {
+			if _, err := p.length(); err != nil {
+				return err
+			}
+		}
+
+		// group PEL: raw id, delivery time, delivery count
+		err := p.repeat(1, func() error {
+			if err := p.skip(16 + 8); err != nil {
+				return err
+			}
+			_, err := p.length()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		return p.repeat(1, func() error { // consumers
+			if err := p.skipStr(); err != nil {
+				return err
+			}
+			times := int64(8) // seen time
+			if t >= 21 {
+				times += 8 // active time
+			}
+			if err := p.skip(times); err != nil {
+				return err
+			}
+			n, err := p.length()
+			if err != nil {
+				return err
+			}
+			return p.skip(int64(n) * 16)
+		})
+	})
+}
+
+func (p *parser) skipModuleAux() error {
+	if _, err := p.length(); err != nil { // module id
+		return err
+	}
+	if _, err := p.length(); err != nil { // when opcode
+		return err
+	}
+	if _, err := p.length(); err != nil { // when
+		return err
+	}
+	return p.skipModuleOpcodes()
+}
+
+func (p *parser) skipModuleOpcodes() error {
+	for {
+		op, err := p.length()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case moduleOpEOF:
+			return nil
+		case moduleOpSInt, moduleOpUInt:
+			_, err = p.length()
+		case moduleOpFloat:
+			err = p.skip(4)
+		case moduleOpDbl:
+			err = p.skip(8)
+		case moduleOpStr:
+			err = p.skipStr()
+		default:
+			return fmt.Errorf("%w: module opcode %d", errUnsupported, op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// repeat reads a length and calls fn length*per times.
+func (p *parser) repeat(per uint64, fn func() error) error {
+	n, err := p.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n*per; i++ {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) skip(n int64) error {
+	if n < 0 || n > math.MaxInt {
+		return fmt.Errorf("%w: skip of %d bytes", ErrInvalid, n)
+	}
+	_, err := p.r.Discard(int(n))
+	return err
+}
+
+func (p *parser) skipDoubleString() error {
+	n, err := p.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if n >= 253 { // NaN, +inf, -inf
+		return nil
+	}
+	return p.skip(int64(n))
+}
+
+// lengthOrEncoding decodes a length. When encoded is true, n is the special
+// string encoding (0 int8, 1 int16, 2 int32, 3 LZF) instead of a length.
+func (p *parser) lengthOrEncoding() (n uint64, encoded bool, err error) {
+	b, err := p.r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3F), false, nil
+	case 1:
+		b2, err := p.r.ReadByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3F)<<8 | uint64(b2), false, nil
+	case 2:
+		switch b {
+		case 0x80:
+			var buf [4]byte
+			if _, err := io.ReadFull(p.r, buf[:]); err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(buf[:])), false, nil
+		case 0x81:
+			var buf [8]byte
+			if _, err := io.ReadFull(p.r, buf[:]); err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(buf[:]), false, nil
+		}
+		return 0, false, fmt.Errorf("%w: length prefix 0x%02x", ErrInvalid, b)
+	default:
+		return uint64(b & 0x3F), true, nil
+	}
+}
+
+func (p *parser) length() (uint64, error) {
+	n, encoded, err := p.lengthOrEncoding()
+	if err == nil && encoded {
+		err = fmt.Errorf("%w: unexpected string encoding where a length was expected", ErrInvalid)
+	}
+	return n, err
+}
+
+// str reads a string, expanding integer and LZF encodings.
+func (p *parser) str() ([]byte, error) {
+	n, encoded, err := p.lengthOrEncoding()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		return p.readN(n)
+	}
+
+	switch n {
+	case 0, 1, 2:
+		size := 1 << n
+		buf, err := p.readN(uint64(size))
+		if err != nil {
+			return nil, err
+		}
+		var v int64
+		switch size {
+		case 1:
+			v = int64(int8(buf[0]))
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(buf)))
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(buf)))
+		}
+		return strconv.AppendInt(nil, v, 10), nil
+	case 3:
+		clen, err := p.length()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := p.length()
+		if err != nil {
+			return nil, err
+		}
+		in, err := p.readN(clen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(in, ulen)
+	}
+	return nil, fmt.Errorf("%w: string encoding %d", ErrInvalid, n)
+}
+
+// skipStr skips a string without decoding it.
+func (p *parser) skipStr() error {
+	n, encoded, err := p.lengthOrEncoding()
+	if err != nil {
+		return err
+	}
+	if !encoded {
+		return p.skip(int64(n))
+	}
+	switch n {
+	case 0, 1, 2:
+		return p.skip(1 << n)
+	case 3:
+		clen, err := p.length()
+		if err != nil {
+			return err
+		}
+		if _, err := p.length(); err != nil {
+			return err
+		}
+		return p.skip(int64(clen))
+	}
+	return fmt.Errorf("%w: string encoding %d", ErrInvalid, n)
+}
+
+// readN reads a small string; aux values are at most a few KiB.
+func (p *parser) readN(n uint64) ([]byte, error) {
+	if n > 64<<20 {
+		return nil, fmt.Errorf("%w: string of %d bytes", ErrInvalid, n)
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(p.r, buf)
+	return buf, err
+}
+
+func lzfDecompress(in []byte, outLen uint64) ([]byte, error) {
+	if outLen > 64<<20 {
+		return nil, fmt.Errorf("%w: lzf string of %d bytes", ErrInvalid, outLen)
+	}
+	out := make([]byte, 0, outLen)
+
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		if ctrl < 32 { // literal run
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, fmt.Errorf("%w: lzf literal overrun", ErrInvalid)
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, fmt.Errorf("%w: lzf truncated", ErrInvalid)
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, fmt.Errorf("%w: lzf truncated", ErrInvalid)
+		}
+		ref := len(out) - ((ctrl & 0x1F) << 8) - 1 - int(in[i])
+		i++
+		if ref < 0 {
+			return nil, fmt.Errorf("%w: lzf back reference out of range", ErrInvalid)
+		}
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if uint64(len(out)) != outLen {
+		return nil, fmt.Errorf("%w: lzf length %d, expected %d", ErrInvalid, len(out), outLen)
+	}
+	return out, nil
+}
+
+// fillWellKnown lifts the commonly used aux fields into typed fields.
+func (m *Metadata) fillWellKnown() {
+	m.RedisVersion = m.Aux["redis-ver"]
+	if m.RedisVersion == "" {
+		m.RedisVersion = m.Aux["valkey-ver"]
+	}
+	if v, err := strconv.ParseInt(m.Aux["ctime"], 10, 64); err == nil && v > 0 {
+		m.CTime = time.Unix(v, 0).UTC()
+	}
+	if v, err := strconv.ParseInt(m.Aux["used-mem"], 10, 64); err == nil {
+		m.UsedMem = v
+	}
+	m.ReplID = m.Aux["repl-id"]
+	if v, err := strconv.ParseInt(m.Aux["repl-offset"], 10, 64); err == nil {
+		m.ReplOffset = v
+	}
+	m.AOFBase = m.Aux["aof-base"] == "1"
+}
+
+// InspectFile validates the RDB file at path and extracts its metadata. See Inspect.
+func InspectFile(path string) (Result, *Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	defer f.Close()
+	return Inspect(f)
+}
+
+// Inspect validates the RDB like Validate and, in the same pass, extracts its
+// metadata. Metadata is returned even when validation fails; it then holds
+// whatever could be read before the damage.
+func Inspect(r io.Reader) (Result, *Metadata, error) {
+	pr, pw := io.Pipe()
+	done := make(chan *Metadata, 1)
+	go func() {
+		meta := parse(pr)
+		_, _ = io.Copy(io.Discard, pr) // keep the validator flowing to the trailer
+		done <- meta
+	}()
+
+	res, err := Validate(io.TeeReader(r, pw))
+	_ = pw.Close()
+	return res, <-done, err
+}
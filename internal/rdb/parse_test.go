@@ -0,0 +1,105 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// auxStr encodes an aux field with plain length-prefixed strings.
+func auxStr(k, v string) []byte {
+	out := []byte{opAux, byte(len(k))}
+	out = append(out, k...)
+	out = append(out, byte(len(v)))
+	return append(out, v...)
+}
+
+func TestInspect(t *testing.T) {
+	var ctime [4]byte
+	binary.LittleEndian.PutUint32(ctime[:], 1767323045)
+
+	var body []byte
+	body = append(body, auxStr("redis-ver", "7.2.4")...)
+	body = append(body, opAux, 5, 'c', 't', 'i', 'm', 'e', 0xC2) // int32 encoded
+	body = append(body, ctime[:]...)
+	body = append(body, opAux, 8, 'u', 's', 'e', 'd', '-', 'm', 'e', 'm', 0xC1, 0x00, 0x10) // int16: 4096
+	body = append(body, opAux, 3, 'l', 'z', 'f', 0xC3, 4, 6, 0x00, 'a', 0x60, 0x00)         // LZF: "aaaaaa"
+	body = append(body, auxStr("aof-base", "0")...)
+	body = append(body, opSelectDB, 0, opResizeDB, 3, 1)
+	body = append(body, opExpireMS, 1, 2, 3, 4, 5, 6, 7, 8, 0, 1, 'a', 1, '1') // string with TTL
+	body = append(body, 0, 1, 'b', 0xC0, 5)                                    // int8 encoded value
+	body = append(body, 4, 1, 'h', 1, 1, 'f', 1, 'v')                          // hash, one field
+	body = append(body, opSelectDB, 2, opResizeDB, 1, 0)
+	body = append(body, 2, 1, 's', 2, 1, 'x', 1, 'y') // set, two members
+
+	tests := []struct {
+		name         string
+		body         []byte
+		wantComplete bool
+		wantKeys     uint64
+	}{
+		{"complete", append(bytes.Clone(body), opEOF), true, 4},
+		{"unsupported opcode", append(append(bytes.Clone(body), 0xF0), opEOF), false, 4},
+		{"unsupported value type", append(append(bytes.Clone(body), 6, 1, 'k'), opEOF), false, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, meta, err := Inspect(bytes.NewReader(rdbFile("REDIS0011", tt.body, nil)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !res.Verified {
+				t.Fatal("checksum not verified")
+			}
+			if meta.Complete != tt.wantComplete {
+				t.Fatalf("Complete = %v (%s), want %v", meta.Complete, meta.ParseError, tt.wantComplete)
+			}
+			if meta.Complete == (meta.ParseError != "") {
+				t.Fatalf("Complete = %v with ParseError %q", meta.Complete, meta.ParseError)
+			}
+
+			// Aux fields precede the keys, so they survive an early stop.
+			if meta.RedisVersion != "7.2.4" {
+				t.Fatalf("RedisVersion = %q", meta.RedisVersion)
+			}
+			if want := time.Unix(1767323045, 0).UTC(); !meta.CTime.Equal(want) {
+				t.Fatalf("CTime = %s, want %s", meta.CTime, want)
+			}
+			if meta.UsedMem != 4096 {
+				t.Fatalf("UsedMem = %d, want 4096", meta.UsedMem)
+			}
+			if meta.Aux["lzf"] != "aaaaaa" {
+				t.Fatalf("lzf aux = %q, want aaaaaa", meta.Aux["lzf"])
+			}
+			if meta.AOFBase {
+				t.Fatal("AOFBase set")
+			}
+
+			if len(meta.Databases) != 2 {
+				t.Fatalf("%d databases, want 2", len(meta.Databases))
+			}
+			db0, db2 := meta.Databases[0], meta.Databases[1]
+			if db0.Index != 0 || db0.ResizeKeys != 3 || db0.ResizeExpires != 1 || db0.Keys != 3 || db0.KeysWithExpiry != 1 {
+				t.Fatalf("db 0 = %+v", db0)
+			}
+			if db2.Index != 2 || db2.Keys != 1 || db2.KeysWithExpiry != 0 {
+				t.Fatalf("db 2 = %+v", db2)
+			}
+			if got := meta.KeyCount(); got != tt.wantKeys {
+				t.Fatalf("KeyCount = %d, want %d", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestInspectInvalid(t *testing.T) {
+	data := rdbFile("REDIS0011", append(auxStr("redis-ver", "7.2.4"), opEOF), func(c uint64) uint64 { return c ^ 1 })
+	_, meta, err := Inspect(bytes.NewReader(data))
+	if err == nil {
+		t.Fatal("Inspect accepted a bad checksum")
+	}
+	if meta == nil || meta.RedisVersion != "7.2.4" {
+		t.Fatalf("metadata of a damaged file = %+v, want what was read", meta)
+	}
+}
@@ -0,0 +1,137 @@
+// Package rdb reads Redis and Valkey RDB files.
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const (
+	opEOF = 0xFF
+
+	// checksumVersion is the first RDB version carrying a CRC64 trailer.
+	checksumVersion = 5
+)
+
+// ErrInvalid is wrapped by every validation failure.
+var ErrInvalid = errors.New("invalid rdb")
+
+// Header is the identifying prefix of an RDB file.
+type Header struct {
+	Magic   string // "REDIS" or "VALKEY"
+	Version int
+}
+
+// Result describes a validated RDB file.
+type Result struct {
+	Header
+	Size     int64
+	Checksum uint64 // trailer value; 0 when the server runs with rdbchecksum no
+	Verified bool   // the CRC64 trailer was present and matched
+}
+
+// ValidateFile checks the RDB file at path. See Validate.
+func ValidateFile(path string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	return Validate(f)
+}
+
+// Validate streams an RDB and checks the magic, the version, the EOF opcode
+// and the CRC64 trailer. A zero trailer means checksums were disabled on the
+// server; the file is then accepted with Verified set to false.
+func Validate(r io.Reader) (Result, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+
+	hdr, raw, err := readHeader(br)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{Header: hdr, Size: int64(len(raw))}
+	hasTrailer := hdr.Version >= checksumVersion
+	trailer := 0
+	if hasTrailer {
+		trailer = 8
+	}
+
+	// Everything but the trailer is hashed. The trailer is only known once the
+	// stream ends, so the last bytes are held back in pending.
+	crc := crcUpdate(0, raw)
+	pending := make([]byte, 0, 2*64<<10)
+	buf := make([]byte, 64<<10)
+	var last byte
+
+	for {
+		n, err := br.Read(buf)
+		pending = append(pending, buf[:n]...)
+		res.Size += int64(n)
+
+		if keep := len(pending) - trailer; keep > 0 {
+			crc = crcUpdate(crc, pending[:keep])
+			last = pending[keep-1]
+			pending = append(pending[:0], pending[keep:]...)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+
+	if len(pending) < trailer || res.Size <= int64(len(raw)+trailer) {
+		return res, fmt.Errorf("%w: truncated file (%d bytes)", ErrInvalid, res.Size)
+	}
+	if last != opEOF {
+		return res, fmt.Errorf("%w: missing EOF opcode (got 0x%02x)", ErrInvalid, last)
+	}
+	if !hasTrailer {
+		return res, nil
+	}
+
+	res.Checksum = binary.LittleEndian.Uint64(pending)
+	if res.Checksum == 0 {
+		return res, nil
+	}
+	if res.Checksum != crc {
+		return res, fmt.Errorf("%w: checksum mismatch (trailer %016x, computed %016x)", ErrInvalid, res.Checksum, crc)
+	}
+	res.Verified = true
+	return res, nil
+}
+
+// readHeader reads "REDIS" + 4 digit or "VALKEY" + 3 digit magic and version.
+func readHeader(br *bufio.Reader) (Header, []byte, error) {
+	raw := make([]byte, 9)
+	if _, err := io.ReadFull(br, raw); err != nil {
+		return Header{}, nil, fmt.Errorf("%w: reading header: %v", ErrInvalid, err)
+	}
+
+	var hdr Header
+	var digits string
+	switch {
+	case string(raw[:5]) == "REDIS":
+		hdr.Magic, digits = "REDIS", string(raw[5:])
+	case string(raw[:6]) == "VALKEY":
+		hdr.Magic, digits = "VALKEY", string(raw[6:])
+	default:
+		return Header{}, nil, fmt.Errorf("%w: bad magic %q", ErrInvalid, raw[:6])
+	}
+
+	v, err := strconv.Atoi(digits)
+	if err != nil || v < 1 {
+		return Header{}, nil, fmt.Errorf("%w: bad version %q", ErrInvalid, digits)
+	}
+	hdr.Version = v
+	return hdr, raw, nil
+}
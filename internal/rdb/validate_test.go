@@ -0,0 +1,87 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// rdbFile returns header followed by body and, from version 5 on, the CRC64
+// trailer computed by crc; crc nil writes the correct one.
+func rdbFile(header string, body []byte, crc func(uint64) uint64) []byte {
+	out := append([]byte(header), body...)
+	if header[len(header)-4:] < "0005" && header[:5] == "REDIS" {
+		return out
+	}
+	sum := crcUpdate(0, out)
+	if crc != nil {
+		sum = crc(sum)
+	}
+	return binary.LittleEndian.AppendUint64(out, sum)
+}
+
+func TestCRC64Jones(t *testing.T) {
+	// Check value of CRC-64/Jones, as in the Redis crc64 self test.
+	if got := crcUpdate(0, []byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("crc = %016x, want e9c6d914c4b8d9ca", got)
+	}
+	if got := crcUpdate(crcUpdate(0, []byte("1234")), []byte("56789")); got != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("crc in two updates = %016x, want e9c6d914c4b8d9ca", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	body := []byte{opAux, 9, 'r', 'e', 'd', 'i', 's', '-', 'v', 'e', 'r', 5, '7', '.', '2', '.', '4', opEOF}
+	valid := rdbFile("REDIS0011", body, nil)
+
+	// An aux value larger than the read buffer, so the trailer is held back
+	// across reads.
+	big := []byte{opAux, 1, 'x', 0x80, 0, 2, 0, 0}
+	big = append(append(big, bytes.Repeat([]byte{'v'}, 2<<16)...), opEOF)
+
+	tests := []struct {
+		name         string
+		data         []byte
+		wantErr      bool
+		wantVerified bool
+		wantVersion  int
+	}{
+		{"valid", valid, false, true, 11},
+		{"valkey", rdbFile("VALKEY080", body, nil), false, true, 80},
+		{"spans read buffers", rdbFile("REDIS0011", big, nil), false, true, 11},
+		{"spans read buffers, bad checksum", rdbFile("REDIS0011", big, func(c uint64) uint64 { return c + 1 }), true, false, 11},
+		{"checksum disabled", rdbFile("REDIS0011", body, func(uint64) uint64 { return 0 }), false, false, 11},
+		{"no trailer before version 5", rdbFile("REDIS0004", body, nil), false, false, 4},
+		{"bad checksum", rdbFile("REDIS0011", body, func(c uint64) uint64 { return c ^ 1 }), true, false, 11},
+		{"corrupt body", append(append([]byte(nil), valid[:12]...), append([]byte{'X'}, valid[13:]...)...), true, false, 11},
+		{"truncated trailer", valid[:len(valid)-3], true, false, 11},
+		{"truncated body", valid[:len(valid)-10], true, false, 11},
+		{"header only", []byte("REDIS0011"), true, false, 11},
+		{"short header", []byte("REDIS"), true, false, 0},
+		{"missing EOF opcode", rdbFile("REDIS0011", body[:len(body)-1], nil), true, false, 11},
+		{"bad magic", rdbFile("MEMCA0011", body, nil), true, false, 0},
+		{"bad version", rdbFile("REDIS00x1", body, nil), true, false, 0},
+		{"zero version", rdbFile("REDIS0000", body, nil), true, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Validate(bytes.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalid) {
+				t.Fatalf("error %v does not wrap ErrInvalid", err)
+			}
+			if res.Verified != tt.wantVerified {
+				t.Fatalf("Verified = %v, want %v", res.Verified, tt.wantVerified)
+			}
+			if res.Version != tt.wantVersion {
+				t.Fatalf("Version = %d, want %d", res.Version, tt.wantVersion)
+			}
+			if err == nil && res.Size != int64(len(tt.data)) {
+				t.Fatalf("Size = %d, want %d", res.Size, len(tt.data))
+			}
+		})
+	}
+}
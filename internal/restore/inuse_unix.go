@@ -0,0 +1,71 @@
+//go:build unix
+
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// inUse reports whether path looks like it is used by a running server. It is
+// best effort: servers in other containers or PID namespaces go unnoticed.
+// It checks for a held flock (Redis locks nodes.conf in cluster mode) and,
+// where /proc is visible, for processes holding the file open or running
+// with the data dir as working directory (Redis chdirs into its "dir").
+func inUse(path string) (bool, string) {
+	if locked(path) {
+		return true, "file is locked by another process"
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, ""
+	}
+	dir := filepath.Dir(abs)
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return false, ""
+	}
+	self := strconv.Itoa(os.Getpid())
+
+	for _, p := range procs {
+		pid := p.Name()
+		if !p.IsDir() || pid[0] < '0' || pid[0] > '9' || pid == self {
+			continue
+		}
+		base := filepath.Join("/proc", pid)
+
+		if cwd, err := os.Readlink(filepath.Join(base, "cwd")); err == nil && cwd == dir {
+			return true, "process " + pid + " runs in " + dir
+		}
+
+		fds, err := os.ReadDir(filepath.Join(base, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(base, "fd", fd.Name())); err == nil && target == abs {
+				return true, "process " + pid + " has the file open"
+			}
+		}
+	}
+
+	return false, ""
+}
+
+func locked(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return err == syscall.EWOULDBLOCK
+	}
+	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return false
+}
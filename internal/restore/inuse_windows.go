@@ -0,0 +1,9 @@
+//go:build windows
+
+package restore
+
+// inUse is not implemented on Windows; restores there are for development only.
+func inUse(path string) (bool, string) {
+	_ = path
+	return false, ""
+}
@@ -0,0 +1,410 @@
+// Package restore materializes an archived snapshot back into a Redis data dir.
+package restore
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/raoulx24/rdb-archiver/internal/aof"
+	"github.com/raoulx24/rdb-archiver/internal/crypt"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+)
+
+// Options selects the archive to restore and where to put it.
+type Options struct {
+	Rule   string // rule folder to restore from
+	At     string // snapshot timestamp, e.g. 2025-02-24T23-59-00
+	Latest bool   // restore the newest snapshot of the rule
+	Dir    string // target data dir
+	// RedisStopped confirms that no server uses Dir. The in-use check cannot
+	// see processes in other containers or PID namespaces, so it is only a
+	// second line of defence.
+	RedisStopped bool
+	Force        bool // restore without the confirmation and the in-use check
+}
+
+// Restorer extracts archives from a destination into a local dir.
+type Restorer struct {
+	src   fs.FS
+	local *fs.OSFS
+	keys  *crypt.Keys
+	logg  logging.Logger
+}
+
+// New creates a restorer reading archives from src. keys opens sealed
+// archives and may be nil when none are expected.
+func New(src fs.FS, local *fs.OSFS, keys *crypt.Keys, log logging.Logger) *Restorer {
+	return &Restorer{src: src, local: local, keys: keys, logg: log.With("pkg", "restore")}
+}
+
+// Run restores one snapshot from root/<rule> into opts.Dir.
+// Files are staged next to their final location, the archive is read to the end
+// to verify the codec checksums and the SHA-256 digests of its manifest sidecar,
+// and only then are the staged files renamed into place. Files they replace are
+// kept aside until all are in place, so a failed swap leaves the dir as it was.
+func (r *Restorer) Run(ctx context.Context, root string, opts Options) error {
+	if !opts.Force && !opts.RedisStopped {
+		return errors.New("stop the server using the data dir and confirm it with --redis-stopped, or use --force")
+	}
+	ruleDir := filepath.Join(root, opts.Rule)
+
+	archive, err := r.resolve(ctx, ruleDir, opts)
+	if err != nil {
+		return err
+	}
+	r.logg.Info("restoring snapshot", "archive", archive, "dir", opts.Dir)
+
+	if err := r.local.MkdirAll(opts.Dir); err != nil {
+		return fmt.Errorf("creating target dir: %w", err)
+	}
+
+	sums, err := r.checksums(ctx, archive)
+	if err != nil {
+		return err
+	}
+	if sums == nil {
+		r.logg.Warn("no checksums in manifest sidecar, relying on the codec checksum", "archive", archive)
+	}
+
+	in, err := r.src.Open(ctx, archive)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer in.Close()
+
+	// Hash exactly what is stored, to compare it with the sidecar.
+	stored := fs.NewHasher()
+	raw := io.TeeReader(in, stored)
+
+	content, codec, sealed, err := crypt.Open(raw, archive, r.keys)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	if sealed != nil {
+		r.logg.Info("decrypting archive", "mode", sealed.Mode, "keyIds", sealed.KeyIDs)
+	}
+
+	staged := make(map[string]string) // final path -> staged tmp path
+	seen := make(map[string]bool)     // member names
+	cleanup := func() {
+		for _, tmp := range staged {
+			_ = os.Remove(tmp)
+		}
+	}
+
+	err = fs.ReadCompressedTar(content, codec, func(hdr *tar.Header, body io.Reader) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if hdr.Name == manifest.FileName {
+			return nil // describes the archive, not part of the snapshot
+		}
+		var want fs.Digest
+		if sums != nil {
+			var ok bool
+			if want, ok = sums.Member(hdr.Name); !ok {
+				return fmt.Errorf("member %s not in manifest", hdr.Name)
+			}
+		}
+
+		final, err := memberPath(opts.Dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		if !opts.Force {
+			if busy, why := inUse(final); busy {
+				return fmt.Errorf("%s looks in use (%s); stop the server or use --force", final, why)
+			}
+		}
+
+		h := fs.NewHasher()
+		tmp, err := stageFile(final, io.TeeReader(body, h), hdr)
+		if err != nil {
+			return fmt.Errorf("staging %s: %w", hdr.Name, err)
+		}
+		staged[final] = tmp
+		if got := h.Digest(hdr.Name); sums != nil && got != want {
+			return fmt.Errorf("member %s sha256 %s (%d bytes), manifest has %s (%d bytes)",
+				hdr.Name, got.SHA256, got.Size, want.SHA256, want.Size)
+		}
+		seen[hdr.Name] = true
+		r.logg.Debug("member staged", "name", hdr.Name, "size", hdr.Size)
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("extracting %s: %w", archive, err)
+	}
+	if len(staged) == 0 {
+		return fmt.Errorf("archive %s contains no files", archive)
+	}
+	if sums != nil {
+		// Anything the decoder left unread still counts towards the stored bytes.
+		_, err := io.Copy(io.Discard, raw)
+		if err == nil {
+			err = compareArchive(stored.Digest(""), sums.Archive)
+		}
+		for _, d := range sums.Members {
+			if err == nil && d.Name != manifest.FileName && !seen[d.Name] {
+				err = fmt.Errorf("member %s missing from archive", d.Name)
+			}
+		}
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("verifying %s: %w", archive, err)
+		}
+	}
+
+	// All members are verified; swap them in.
+	finals := make([]string, 0, len(staged))
+	for final := range staged {
+		finals = append(finals, final)
+	}
+	// AOF manifests go last: Redis never sees a manifest naming missing files.
+	sort.Slice(finals, func(i, j int) bool {
+		mi, mj := isAOFManifest(finals[i]), isAOFManifest(finals[j])
+		if mi != mj {
+			return mj
+		}
+		return finals[i] < finals[j]
+	})
+
+	if err := r.swap(ctx, finals, staged); err != nil {
+		cleanup()
+		return err
+	}
+
+	for _, final := range finals {
+		if isAOFManifest(final) {
+			r.removeStaleAOF(ctx, final)
+		}
+	}
+
+	return nil
+}
+
+// swap renames the staged files over finals in order. Existing files are moved
+// aside first; if a rename fails, the files already swapped are put back.
+func (r *Restorer) swap(ctx context.Context, finals []string, staged map[string]string) error {
+	backups := make(map[string]string, len(finals)) // final path -> previous file
+	var done []string
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			final := done[i]
+			var err error
+			if old, ok := backups[final]; ok {
+				err = r.local.Rename(ctx, old, final)
+				delete(backups, final)
+			} else {
+				err = os.Remove(final)
+			}
+			if err != nil {
+				r.logg.Error("rolling back restored file failed", "path", final, "error", err)
+			}
+		}
+		for final, old := range backups {
+			if err := r.local.Rename(ctx, old, final); err != nil {
+				r.logg.Error("putting back replaced file failed", "path", final, "backup", old, "error", err)
+			}
+		}
+	}
+
+	for _, final := range finals {
+		if _, err := os.Lstat(final); err == nil {
+			old := filepath.Join(filepath.Dir(final), ".restore-old-"+filepath.Base(final))
+			if err := r.local.Rename(ctx, final, old); err != nil {
+				rollback()
+				return fmt.Errorf("moving %s aside: %w", final, err)
+			}
+			backups[final] = old
+		}
+		if err := r.local.Rename(ctx, staged[final], final); err != nil {
+			rollback()
+			return fmt.Errorf("moving %s into place (restored files rolled back): %w", final, err)
+		}
+		delete(staged, final)
+		done = append(done, final)
+	}
+
+	for _, final := range done {
+		if old, ok := backups[final]; ok {
+			if err := os.Remove(old); err != nil {
+				r.logg.Warn("removing replaced file failed", "path", old, "error", err)
+			}
+		}
+		r.logg.Info("file restored", "path", final)
+	}
+	return nil
+}
+
+// checksums returns the digests recorded in the sidecar of archive, or nil
+// when there is no sidecar or it predates checksums.
+func (r *Restorer) checksums(ctx context.Context, archive string) (*fs.Checksums, error) {
+	in, err := r.src.Open(ctx, manifest.SidecarPath(archive))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	defer in.Close()
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if m.Checksums != nil {
+		if name := m.Checksums.Archive.Name; name != "" && name != filepath.Base(archive) {
+			return nil, fmt.Errorf("manifest sidecar describes %s", name)
+		}
+	}
+	return m.Checksums, nil
+}
+
+func compareArchive(got, want fs.Digest) error {
+	if got.Size != want.Size || got.SHA256 != want.SHA256 {
+		return fmt.Errorf("archive sha256 %s (%d bytes), manifest has %s (%d bytes)",
+			got.SHA256, got.Size, want.SHA256, want.Size)
+	}
+	return nil
+}
+
+func isAOFManifest(path string) bool {
+	return strings.HasSuffix(path, ".aof"+aof.ManifestSuffix)
+}
+
+// removeStaleAOF deletes AOF files left in the restored appendonlydir that the
+// restored manifest no longer lists. Redis ignores them, but a later rewrite
+// could otherwise pick up a sequence number that clashes with them.
+func (r *Restorer) removeStaleAOF(ctx context.Context, manifestPath string) {
+	m, err := aof.ParseManifestFile(manifestPath)
+	if err != nil {
+		r.logg.Warn("restored aof manifest unreadable, leaving aof dir as is", "path", manifestPath, "error", err)
+		return
+	}
+
+	keep := map[string]bool{filepath.Base(manifestPath): true}
+	for _, f := range m.Files {
+		keep[f.Name] = true
+	}
+	prefix := strings.TrimSuffix(filepath.Base(manifestPath), aof.ManifestSuffix) + "."
+
+	dir := filepath.Dir(manifestPath)
+	entries, err := r.local.ReadDir(ctx, dir)
+	if err != nil {
+		r.logg.Warn("listing aof dir failed", "dir", dir, "error", err)
+		return
+	}
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || keep[name] || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		r.logg.Info("removing stale aof file", "path", path)
+		if err := r.local.RemoveAll(ctx, path); err != nil {
+			r.logg.Warn("removing stale aof file failed", "path", path, "error", err)
+		}
+	}
+}
+
+// resolve returns the archive path for opts inside ruleDir.
+func (r *Restorer) resolve(ctx context.Context, ruleDir string, opts Options) (string, error) {
+	if !opts.Latest {
+		if opts.At == "" {
+			return "", errors.New("either a timestamp or latest must be given")
+		}
+		var lastErr error
+		for _, ext := range fs.ArchiveExts() {
+			path := filepath.Join(ruleDir, opts.At+ext)
+			if _, err := r.src.Stat(ctx, path); err != nil {
+				lastErr = err
+				continue
+			}
+			return path, nil
+		}
+		return "", fmt.Errorf("snapshot %s not found in %s: %w", opts.At, ruleDir, lastErr)
+	}
+
+	entries, err := r.src.ReadDir(ctx, ruleDir)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", ruleDir, err)
+	}
+
+	var newest, newestBase string
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		base, ok := fs.TrimArchiveExt(name)
+		if !ok {
+			continue
+		}
+		if base > newestBase {
+			newest, newestBase = name, base
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("no snapshots in %s", ruleDir)
+	}
+	return filepath.Join(ruleDir, newest), nil
+}
+
+// memberPath maps an archive member to its location in dir, rejecting names
+// that would escape it.
+func memberPath(dir, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("unsafe archive member %q", name)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// stageFile writes body into a temp file next to final and syncs it.
+func stageFile(final string, body io.Reader, hdr *tar.Header) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(final), 0o755); err != nil {
+		return "", err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(final), ".restore-"+filepath.Base(final)+"-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := out.Name()
+
+	n, err := io.Copy(out, body)
+	if err == nil && n != hdr.Size {
+		err = fmt.Errorf("short member: %d of %d bytes", n, hdr.Size)
+	}
+	if err == nil {
+		err = out.Chmod(os.FileMode(hdr.Mode).Perm())
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+
+	_ = os.Chtimes(tmp, hdr.ModTime, hdr.ModTime)
+	return tmp, nil
+}
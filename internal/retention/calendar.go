@@ -0,0 +1,41 @@
+package retention
+
+import "time"
+
+// periods map a time to the key of its hourly, daily, weekly, monthly and
+// yearly bucket, in policy.calendar order.
+var periods = [...]func(t time.Time) int{
+	func(t time.Time) int { return t.Year()*100000 + t.YearDay()*100 + t.Hour() }, // hourly
+	func(t time.Time) int { return t.Year()*1000 + t.YearDay() },                  // daily
+	func(t time.Time) int { y, w := t.ISOWeek(); return y*100 + w },               // weekly
+	func(t time.Time) int { return t.Year()*100 + int(t.Month()) },                // monthly
+	func(t time.Time) int { return t.Year() },                                     // yearly
+}
+
+// calendarKeeps marks, for every period, the newest archive of each of the
+// latest n buckets holding one, n being the period count in p.calendar.
+// Buckets follow the calendar of p.loc. archives are sorted newest first;
+// those skip reports are left out and use no bucket.
+func (p policy) calendarKeeps(archives []stored, skip func(i int) bool) []bool {
+	keep := make([]bool, len(archives))
+	for k, bucket := range periods {
+		left := p.calendar[k]
+		last, seen := 0, false
+		for i, a := range archives {
+			if left <= 0 {
+				break
+			}
+			if skip(i) {
+				continue
+			}
+			key := bucket(a.ts.In(p.loc))
+			if seen && key == last {
+				continue
+			}
+			keep[i] = true
+			last, seen = key, true
+			left--
+		}
+	}
+	return keep
+}
@@ -1,6 +1,11 @@
 ﻿package retention
 
 type Config struct {
+	Target               string // destination target name, labels the metrics
 	RemoveUnknownFolders bool
 	Rules                []Rule
+	Reserved             []string // folders kept by removeUnknownFolders although no rule owns them
+	// EvictionOrder lists the rule folders Evict takes archives from first;
+	// unlisted rules follow in their configured order.
+	EvictionOrder []string
 }
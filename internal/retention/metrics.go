@@ -0,0 +1,33 @@
+package retention
+
+import "github.com/raoulx24/rdb-archiver/internal/metrics"
+
+var promotions = metrics.NewCounter(
+	"rdb_archiver_retention_promotions_total",
+	"Snapshots copied into a rule folder, by target and rule.",
+	"target", "rule",
+)
+
+var deletions = metrics.NewCounter(
+	"rdb_archiver_retention_deletions_total",
+	"Snapshots removed from a rule folder, by target and rule.",
+	"target", "rule",
+)
+
+var archiveBytes = metrics.NewGauge(
+	"rdb_archiver_archive_bytes",
+	"Bytes of the archives kept in a rule folder after retention, by target and rule. Hardlinked archives count in every folder holding them.",
+	"target", "rule",
+)
+
+var storedBytes = metrics.NewGauge(
+	"rdb_archiver_stored_bytes",
+	"Bytes of the archives in all rule folders of a target, counting hardlinked archives once, by target.",
+	"target",
+)
+
+var evictions = metrics.NewCounter(
+	"rdb_archiver_retention_evictions_total",
+	"Snapshots removed from a rule folder to respect a size or free space limit, by target and rule.",
+	"target", "rule",
+)
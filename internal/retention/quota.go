@@ -0,0 +1,132 @@
+package retention
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+)
+
+// Evict removes archives below archiveRoot until fits accepts the bytes still
+// stored in the rule folders. Archives go folder by folder in the eviction
+// order, oldest first; the newest archive of each folder, protected archives
+// and archives younger than their rule minAge are never evicted. A hardlinked
+// archive frees its bytes once its last link is evicted. It reports whether
+// fits was satisfied.
+func (r *Retention) Evict(ctx context.Context, filesystem fs.FS, archiveRoot string, protected map[string]bool, fits func(used int64) bool) bool {
+	r.mu.RLock()
+	rules := append([]Rule(nil), r.cfg.Rules...)
+	order := append([]string(nil), r.cfg.EvictionOrder...)
+	target := r.cfg.Target
+	r.mu.RUnlock()
+
+	type folder struct {
+		rule     Rule
+		minAge   time.Duration
+		archives []stored // oldest first
+	}
+	var (
+		folders []folder
+		used    int64
+		links   = make(map[uint64]int) // by inode, of the listed archives
+	)
+	for _, rule := range evictionOrder(rules, order) {
+		ruleDir := filepath.Join(archiveRoot, rule.Name)
+		archives, _, err := r.listStored(ctx, filesystem, ruleDir, protected)
+		if err != nil {
+			continue // not created yet
+		}
+		for _, a := range archives {
+			if a.inode != 0 {
+				links[a.inode]++
+				if links[a.inode] > 1 {
+					continue
+				}
+			}
+			used += a.size
+		}
+		pol, err := rule.policy()
+		if err != nil {
+			r.logg.Warn("invalid rule, not evicting from it", "rule", rule.Name, "error", err)
+			continue
+		}
+		if len(archives) > 0 {
+			archives = archives[1:] // the newest one stays
+		}
+		slices.Reverse(archives)
+		folders = append(folders, folder{rule: rule, minAge: pol.minAge, archives: archives})
+	}
+
+	defer func() { storedBytes.Set(float64(used), target) }()
+
+	now := time.Now()
+	for _, f := range folders {
+		for _, a := range f.archives {
+			if fits(used) {
+				return true
+			}
+			if a.protected || f.minAge > 0 && now.Sub(a.ts) < f.minAge {
+				continue
+			}
+			full := filepath.Join(archiveRoot, f.rule.Name, a.name)
+			r.logg.Warn("evicting snapshot to free space", "rule", f.rule.Name, "snapshot", a.name, "size", a.size)
+			if err := r.removeArchive(ctx, filesystem, f.rule.Name, full); err != nil {
+				continue
+			}
+			evictions.Inc(target, f.rule.Name)
+			archiveBytes.Add(-float64(a.size), target, f.rule.Name)
+			if a.inode != 0 {
+				links[a.inode]--
+				if links[a.inode] > 0 {
+					continue // still stored in another folder
+				}
+			}
+			used -= a.size
+		}
+	}
+	return fits(used)
+}
+
+// evictionOrder sorts rules by order; unlisted rules keep their relative order
+// after the listed ones.
+func evictionOrder(rules []Rule, order []string) []Rule {
+	out := slices.Clone(rules)
+	rank := func(name string) int {
+		if i := slices.Index(order, name); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+	slices.SortStableFunc(out, func(a, b Rule) int { return rank(a.Name) - rank(b.Name) })
+	return out
+}
+
+// Usage returns the bytes of the archives in the rule folders below
+// archiveRoot, counting hardlinked archives once.
+func (r *Retention) Usage(ctx context.Context, filesystem fs.FS, archiveRoot string) int64 {
+	r.mu.RLock()
+	rules := append([]Rule(nil), r.cfg.Rules...)
+	r.mu.RUnlock()
+	return r.usage(ctx, filesystem, archiveRoot, rules)
+}
+
+func (r *Retention) usage(ctx context.Context, filesystem fs.FS, archiveRoot string, rules []Rule) int64 {
+	var used int64
+	seen := make(map[uint64]bool)
+	for _, rule := range rules {
+		archives, _, err := r.listStored(ctx, filesystem, filepath.Join(archiveRoot, rule.Name), nil)
+		if err != nil {
+			continue
+		}
+		for _, a := range archives {
+			if a.inode != 0 && seen[a.inode] {
+				continue
+			}
+			seen[a.inode] = true
+			used += a.size
+		}
+	}
+	return used
+}
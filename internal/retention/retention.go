@@ -9,9 +9,12 @@ import (
 	"strings"
 	"sync"
 	"time"
+	_ "time/tzdata" // rule timezones work in images without zoneinfo
 
 	"github.com/raoulx24/rdb-archiver/internal/fs"
 	"github.com/raoulx24/rdb-archiver/internal/logging"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
 	"github.com/robfig/cron/v3"
 )
 
@@ -23,9 +26,162 @@ type Retention struct {
 }
 
 type Rule struct {
-	Name  string `yaml:"name"`
-	Cron  string `yaml:"cron"`
-	Count int    `yaml:"count"`
+	Name string `yaml:"name"`
+	// Cron is a standard 5-field spec; a "CRON_TZ=<zone> " prefix evaluates it
+	// in that zone, as Timezone does.
+	Cron     string `yaml:"cron"`
+	Timezone string `yaml:"timezone"` // IANA zone of the cron spec and calendar buckets (default UTC)
+	Count    int    `yaml:"count"`
+	// Time-based retention; durations also accept "d" and "w", as in "30d".
+	// See policy.keeps for how they combine with Count.
+	MinAge     string `yaml:"minAge"`     // never remove archives younger than this
+	MaxAge     string `yaml:"maxAge"`     // always remove archives older than this
+	KeepWithin string `yaml:"keepWithin"` // keep archives within this span of the newest one
+	MaxMB      int    `yaml:"maxMB"`      // size cap of the folder; 0 is unlimited
+	// Calendar retention: the newest archive of each of the latest n hours,
+	// days, ISO weeks, months and years holding one is kept.
+	KeepHourly  int `yaml:"keepHourly"`
+	KeepDaily   int `yaml:"keepDaily"`
+	KeepWeekly  int `yaml:"keepWeekly"`
+	KeepMonthly int `yaml:"keepMonthly"`
+	KeepYearly  int `yaml:"keepYearly"`
+}
+
+// policy is the parsed retention of a rule; zero values are unset.
+type policy struct {
+	count      int
+	minAge     time.Duration
+	maxAge     time.Duration
+	keepWithin time.Duration
+	maxBytes   int64
+	calendar   [len(periods)]int // bucket counts, in periods order
+	loc        *time.Location    // of the calendar buckets
+}
+
+// policy parses the time-based settings of the rule.
+func (r Rule) policy() (policy, error) {
+	p := policy{
+		count:    r.Count,
+		maxBytes: int64(r.MaxMB) << 20,
+		calendar: [...]int{r.KeepHourly, r.KeepDaily, r.KeepWeekly, r.KeepMonthly, r.KeepYearly},
+		loc:      time.UTC,
+	}
+	if r.Timezone != "" {
+		loc, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			return policy{}, fmt.Errorf("invalid timezone %q: %w", r.Timezone, err)
+		}
+		p.loc = loc
+	}
+	for _, f := range []struct {
+		name, value string
+		dst         *time.Duration
+	}{
+		{"minAge", r.MinAge, &p.minAge},
+		{"maxAge", r.MaxAge, &p.maxAge},
+		{"keepWithin", r.KeepWithin, &p.keepWithin},
+	} {
+		if f.value == "" {
+			continue
+		}
+		d, err := ParseDuration(f.value)
+		if err != nil {
+			return policy{}, fmt.Errorf("%s: %w", f.name, err)
+		}
+		*f.dst = d
+	}
+	return p, nil
+}
+
+// stored is a finished archive in a rule folder.
+type stored struct {
+	name      string
+	ts        time.Time // snapshot timestamp from the name
+	size      int64
+	inode     uint64 // shared by the hardlinks of a promoted archive; 0 if unknown
+	protected bool   // member of a kept cluster snapshot set
+}
+
+// keeps reports which of archives, sorted newest first, the policy keeps at
+// now. Rules apply in this order, the first match deciding:
+//  1. archives younger than minAge are kept;
+//  2. archives older than maxAge are removed;
+//  3. the newest count archives are kept, and so are those taken within
+//     keepWithin of the newest one and those calendarKeeps picks for the
+//     keepHourly..keepYearly buckets;
+//  4. all others are removed.
+//
+// With maxBytes, the oldest kept archives are then dropped until the folder
+// fits, sparing the newest one, protected ones and those younger than minAge.
+// Ages are measured from the snapshot timestamps, never from file times.
+func (p policy) keeps(archives []stored, now time.Time) []bool {
+	// Archives past maxAge fill no calendar bucket: a bucket keeps the newest
+	// archive it can.
+	var cal []bool
+	if p.calendar != [len(periods)]int{} {
+		cal = p.calendarKeeps(archives, func(i int) bool {
+			return p.maxAge > 0 && now.Sub(archives[i].ts) > p.maxAge
+		})
+	}
+
+	keep := make([]bool, len(archives))
+	for i, a := range archives {
+		age := now.Sub(a.ts)
+		switch {
+		case p.minAge > 0 && age < p.minAge:
+			keep[i] = true
+		case p.maxAge > 0 && age > p.maxAge:
+			keep[i] = false
+		case i < p.count:
+			keep[i] = true
+		case p.keepWithin > 0 && archives[0].ts.Sub(a.ts) <= p.keepWithin:
+			keep[i] = true
+		case cal != nil && cal[i]:
+			keep[i] = true
+		}
+	}
+
+	if p.maxBytes <= 0 {
+		return keep
+	}
+	var used int64
+	for i, a := range archives {
+		if keep[i] || a.protected {
+			used += a.size
+		}
+	}
+	for i := len(archives) - 1; i > 0 && used > p.maxBytes; i-- {
+		a := archives[i]
+		if !keep[i] || a.protected || p.minAge > 0 && now.Sub(a.ts) < p.minAge {
+			continue
+		}
+		keep[i] = false
+		used -= a.size
+	}
+	return keep
+}
+
+// schedule parses the rule cron spec in the rule timezone, UTC by default.
+// Without a zone the cron library would follow the zone of each time given.
+func (r Rule) schedule() (cron.Schedule, error) {
+	spec := strings.TrimSpace(r.Cron)
+	zoned := strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=")
+	switch {
+	case r.Timezone != "" && zoned:
+		return nil, fmt.Errorf("cron %q sets a zone and timezone is %q: use one of them", r.Cron, r.Timezone)
+	case r.Timezone != "":
+		if _, err := time.LoadLocation(r.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", r.Timezone, err)
+		}
+		spec = "CRON_TZ=" + r.Timezone + " " + spec
+	case !zoned:
+		spec = "CRON_TZ=UTC " + spec
+	}
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron %q: %w", r.Cron, err)
+	}
+	return sched, nil
 }
 
 // New creates a retention engine from cfg.
@@ -43,18 +199,52 @@ func (r *Retention) UpdateConfig(config Config) {
 	r.logg.Debug("updating config")
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.dropMetrics(config)
 	r.cfg = config
 }
 
+// Forget drops the metrics of the target and its rules, for a target removed
+// by a reload.
+func (r *Retention) Forget() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropMetrics(Config{})
+}
+
+// dropMetrics deletes the series of rules that next no longer has, and of the
+// whole target when next labels it differently. Callers hold r.mu.
+func (r *Retention) dropMetrics(next Config) {
+	if r.cfg.Target == "" {
+		return
+	}
+	kept := make(map[string]bool, len(next.Rules))
+	if next.Target == r.cfg.Target {
+		for _, rule := range next.Rules {
+			kept[rule.Name] = true
+		}
+	} else {
+		storedBytes.Delete(r.cfg.Target)
+	}
+	for _, rule := range r.cfg.Rules {
+		if !kept[rule.Name] {
+			archiveBytes.Delete(r.cfg.Target, rule.Name)
+		}
+	}
+}
+
 // Apply promotes the new snapshotwatcher and prunes old ones.
-func (r *Retention) Apply(ctx context.Context, filesystem fs.FS, archiveRoot, newSnapshotFile string) error {
+// Archives listed in protected are never pruned.
+func (r *Retention) Apply(ctx context.Context, filesystem fs.FS, archiveRoot, newSnapshotFile string, protected map[string]bool) error {
 	r.logg.Debug("retention engine is starting to apply rules")
 	r.mu.RLock()
 	rules := append([]Rule(nil), r.cfg.Rules...)
+	target := r.cfg.Target
 	removeUnknownFolders := r.cfg.RemoveUnknownFolders
+	reserved := append([]string(nil), r.cfg.Reserved...)
 	r.mu.RUnlock()
 
-	ts, err := parseTimestamp(strings.TrimSuffix(filepath.Base(newSnapshotFile), ".tar.zst"))
+	base, _ := fs.TrimArchiveExt(filepath.Base(newSnapshotFile))
+	ts, err := parseTimestamp(base)
 	if err != nil {
 		return fmt.Errorf("invalid snapshotwatcher timestamp: %w", err)
 	}
@@ -63,40 +253,44 @@ func (r *Retention) Apply(ctx context.Context, filesystem fs.FS, archiveRoot, ne
 		ruleDir := filepath.Join(archiveRoot, rule.Name)
 
 		if strings.TrimSpace(rule.Cron) != "" {
-			if err := r.promote(ctx, filesystem, rule, ruleDir, newSnapshotFile, ts); err != nil {
+			if err := r.promote(ctx, filesystem, target, rule, ruleDir, newSnapshotFile, ts); err != nil {
 				r.logg.Error("promote failed", "ruleName", rule.Name, "error", err)
 			}
 		}
 
-		if err := r.cleanup(filesystem, rule, ruleDir); err != nil {
+		if err := r.cleanup(ctx, filesystem, target, rule, ruleDir, protected); err != nil {
 			r.logg.Error("retention - cleanup failed", "ruleName", rule.Name, "error", err)
 		}
 	}
 
 	if removeUnknownFolders {
-		if err := r.removeUnknownFolders(filesystem, rules, archiveRoot); err != nil {
+		if err := r.removeUnknownFolders(ctx, filesystem, rules, reserved, archiveRoot); err != nil {
 			r.logg.Error("retention - remove unknown folders failed", "error", err)
 		}
 	}
+	storedBytes.Set(float64(r.usage(ctx, filesystem, archiveRoot, rules)), target)
 
 	return nil
 }
 
 // promote copies the snapshotwatcher if none exists after the cron boundary.
-func (r *Retention) promote(ctx context.Context, filesystem fs.FS, rule Rule, ruleDir, snapFile string, snapTS time.Time) error {
-	sched, err := cron.ParseStandard(rule.Cron)
+func (r *Retention) promote(ctx context.Context, filesystem fs.FS, target string, rule Rule, ruleDir, snapFile string, snapTS time.Time) error {
+	sched, err := rule.schedule()
 	if err != nil {
-		return fmt.Errorf("invalid cron %q: %w", rule.Cron, err)
+		return err
 	}
 
-	prev := prevCron(sched, snapTS)
+	prev, ok := prevCron(sched, snapTS)
+	if !ok {
+		return fmt.Errorf("cron %q has no boundary before %s", rule.Cron, snapTS.Format(time.RFC3339))
+	}
 	next := sched.Next(prev)
 
 	if err := filesystem.MkdirAll(ruleDir); err != nil {
 		return fmt.Errorf("mkdir: %w", err)
 	}
 
-	existing, err := r.listSnapshotFiles(filesystem, ruleDir)
+	existing, err := r.listSnapshotFiles(ctx, filesystem, ruleDir)
 	if err != nil {
 		return err
 	}
@@ -107,56 +301,129 @@ func (r *Retention) promote(ctx context.Context, filesystem fs.FS, rule Rule, ru
 		}
 	}
 
+	// Archives are never modified once written, so rule folders can share
+	// the bytes of the snapshot folder.
 	dst := filepath.Join(ruleDir, filepath.Base(snapFile))
-	r.logg.Info("creating snapshot in cron folder", "rule", rule.Name, "cron", rule.Cron, "snapshot", filepath.Base(snapFile))
-
-	return filesystem.CopyFile(ctx, snapFile, dst)
+	method, err := filesystem.LinkFile(ctx, snapFile, dst)
+	if err != nil {
+		return err
+	}
+	r.logg.Info("creating snapshot in cron folder", "rule", rule.Name, "cron", rule.Cron, "snapshot", filepath.Base(snapFile), "method", method)
+	promotions.Inc(target, rule.Name)
+
+	// The manifest sidecar and its signature travel with their archive; older
+	// archives have neither and unsigned ones have no signature. They are
+	// replaced whole, never rewritten, so they may share storage too.
+	for _, pathFn := range []func(string) string{manifest.SidecarPath, manifest.SignaturePath} {
+		src := pathFn(snapFile)
+		if _, err := filesystem.Stat(ctx, src); err != nil {
+			continue
+		}
+		if _, err := filesystem.LinkFile(ctx, src, pathFn(dst)); err != nil {
+			r.logg.Warn("copying manifest sidecar failed", "rule", rule.Name, "path", src, "error", err)
+		}
+	}
+	return nil
 }
 
-// cleanup keeps only the newest N snapshotwatcher directories.
-func (r *Retention) cleanup(filesystem fs.FS, rule Rule, ruleDir string) error {
-	entries, err := filesystem.ReadDir(ruleDir)
+// cleanup removes the archives of a rule folder its policy does not keep.
+// Protected archives are never removed.
+func (r *Retention) cleanup(ctx context.Context, filesystem fs.FS, target string, rule Rule, ruleDir string, protected map[string]bool) error {
+	pol, err := rule.policy()
+	if err != nil {
+		return err
+	}
+	archives, total, err := r.listStored(ctx, filesystem, ruleDir, protected)
 	if err != nil {
-		return fmt.Errorf("reading folder: %w", err)
+		return err
 	}
+	defer func() { archiveBytes.Set(float64(total), target, rule.Name) }()
 
-	var files []string
-	for _, ent := range entries {
-		if ent.IsDir() {
+	keep := pol.keeps(archives, time.Now())
+	for i, a := range archives {
+		if keep[i] {
 			continue
 		}
-		if strings.HasSuffix(ent.Name(), ".tar.zst") {
-			files = append(files, ent.Name())
+		if a.protected {
+			r.logg.Debug("keeping protected snapshot", "rule", rule.Name, "snapshot", a.name)
+			continue
 		}
+		r.logg.Info("removing old snapshot in cron folder", "rule", rule.Name, "cron", rule.Cron, "snapshot", a.name)
+		if err := r.removeArchive(ctx, filesystem, rule.Name, filepath.Join(ruleDir, a.name)); err != nil {
+			continue
+		}
+		deletions.Inc(target, rule.Name)
+		total -= a.size
+	}
+
+	return nil
+}
+
+// listStored returns the finished archives of a rule folder, newest first,
+// and the bytes of all archives in it.
+func (r *Retention) listStored(ctx context.Context, filesystem fs.FS, ruleDir string, protected map[string]bool) ([]stored, int64, error) {
+	entries, err := filesystem.ReadDir(ctx, ruleDir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading folder: %w", err)
 	}
 
-	if len(files) <= rule.Count {
-		return nil
+	var (
+		archives []stored
+		total    int64
+	)
+	for _, ent := range entries {
+		if ent.IsDir() || !isSnapshotFile(ent.Name()) {
+			continue
+		}
+		a := stored{name: ent.Name(), protected: protected[filepath.Join(ruleDir, ent.Name())]}
+		if info, err := ent.Info(); err == nil {
+			a.size = info.Size()
+			a.inode = fs.InodeOf(info)
+			total += a.size
+		}
+		base, _ := fs.TrimArchiveExt(a.name)
+		if a.ts, err = parseTimestamp(base); err != nil {
+			r.logg.Debug("ignoring archive without snapshot timestamp", "dir", ruleDir, "file", a.name)
+			continue
+		}
+		archives = append(archives, a)
 	}
 
-	sort.Slice(files, func(i, j int) bool {
-		return files[i] > files[j]
+	// Newest first; the name breaks ties between codecs of one snapshot.
+	sort.Slice(archives, func(i, j int) bool {
+		if !archives[i].ts.Equal(archives[j].ts) {
+			return archives[i].ts.After(archives[j].ts)
+		}
+		return archives[i].name > archives[j].name
 	})
+	return archives, total, nil
+}
 
-	for _, name := range files[rule.Count:] {
-		full := filepath.Join(ruleDir, name)
-		r.logg.Info("removing old snapshot in cron folder", "rule", rule.Name, "cron", rule.Cron, "snapshot", name)
-		if err := filesystem.RemoveAll(full); err != nil {
-			r.logg.Warn("removal of file failed", "rule", rule.Name, "snapshot", name, "error", err)
+// removeArchive removes an archive with its manifest sidecar and signature.
+func (r *Retention) removeArchive(ctx context.Context, filesystem fs.FS, rule, full string) error {
+	if err := filesystem.RemoveAll(ctx, full); err != nil {
+		r.logg.Warn("removal of file failed", "rule", rule, "snapshot", filepath.Base(full), "error", err)
+		return err
+	}
+	for _, side := range []string{manifest.SidecarPath(full), manifest.SignaturePath(full)} {
+		if err := filesystem.RemoveAll(ctx, side); err != nil {
+			r.logg.Warn("removal of manifest sidecar failed", "rule", rule, "path", side, "error", err)
 		}
 	}
-
 	return nil
 }
 
 // removeUnknownFolders removes folders that are not defined in the retention rules.
-func (r *Retention) removeUnknownFolders(filesystem fs.FS, rules []Rule, ruleDir string) error {
+func (r *Retention) removeUnknownFolders(ctx context.Context, filesystem fs.FS, rules []Rule, reserved []string, ruleDir string) error {
 	known := make(map[string]struct{})
 	for _, r := range rules {
 		known[r.Name] = struct{}{}
 	}
+	for _, name := range reserved {
+		known[name] = struct{}{}
+	}
 
-	entries, err := filesystem.ReadDir(ruleDir)
+	entries, err := filesystem.ReadDir(ctx, ruleDir)
 	if err != nil {
 		return err
 	}
@@ -171,7 +438,7 @@ func (r *Retention) removeUnknownFolders(filesystem fs.FS, rules []Rule, ruleDir
 		if _, ok := known[name]; !ok {
 			full := filepath.Join(ruleDir, name)
 			r.logg.Warn("Removing unknown cron folder", "path", full)
-			if err := filesystem.RemoveAll(full); err != nil {
+			if err := filesystem.RemoveAll(ctx, full); err != nil {
 				return fmt.Errorf("removing dir %s: %w", full, err)
 			}
 		}
@@ -181,24 +448,20 @@ func (r *Retention) removeUnknownFolders(filesystem fs.FS, rules []Rule, ruleDir
 }
 
 // listSnapshotDirs returns timestamps of snapshotwatcher directories.
-func (r *Retention) listSnapshotFiles(filesystem fs.FS, dir string) ([]time.Time, error) {
-	entries, err := filesystem.ReadDir(dir)
+func (r *Retention) listSnapshotFiles(ctx context.Context, filesystem fs.FS, dir string) ([]time.Time, error) {
+	entries, err := filesystem.ReadDir(ctx, dir)
 	if err != nil {
 		return nil, err
 	}
 
 	var out []time.Time
 	for _, ent := range entries {
-		if ent.IsDir() {
+		if ent.IsDir() || !isSnapshotFile(ent.Name()) {
 			continue
 		}
 
-		name := ent.Name()
-		if !strings.HasSuffix(name, ".tar.zst") {
-			continue
-		}
+		base, _ := fs.TrimArchiveExt(ent.Name())
 
-		base := strings.TrimSuffix(name, ".tar.zst")
 		ts, err := parseTimestamp(base)
 		if err == nil {
 			out = append(out, ts)
@@ -207,21 +470,48 @@ func (r *Retention) listSnapshotFiles(filesystem fs.FS, dir string) ([]time.Time
 	return out, nil
 }
 
-// parseTimestamp parses snapshotwatcher directory names.
+// isSnapshotFile reports whether name is a finished archive. Archives being
+// written are dot-files (".tmp-<ts>.tar.zst") and are never counted, promoted
+// or removed by retention.
+func isSnapshotFile(name string) bool {
+	return !strings.HasPrefix(name, ".") && fs.IsArchive(name)
+}
+
+// parseTimestamp parses snapshot archive names.
 func parseTimestamp(name string) (time.Time, error) {
-	return time.Parse("2006-01-02T15-04-05", name)
+	return snapshot.ParseTimestamp(name)
 }
 
-// prevCron returns the most recent cron boundary before t.
-func prevCron(s cron.Schedule, t time.Time) time.Time {
-	// Start far enough in the past to guarantee we cross the boundary
-	cur := t.Add(-48 * time.Hour)
+// maxCronLookback bounds the search for a previous boundary; a leap-day
+// schedule fires at least once in eight years.
+const maxCronLookback = 8 * 366 * 24 * time.Hour
+
+// prevCron returns the latest cron boundary at or before t, so that t falls in
+// the window [prev, s.Next(prev)). Boundaries are instants: a schedule in a
+// zone with DST yields the same window whatever zone t is in. ok is false when
+// the schedule has no boundary within maxCronLookback.
+func prevCron(s cron.Schedule, t time.Time) (prev time.Time, ok bool) {
+	// Widen the lookback until a boundary is crossed. Doubling keeps the walk
+	// below short: at most the boundaries in twice the distance to prev.
+	var cur time.Time
+	for back := time.Minute; ; back *= 2 {
+		if back > maxCronLookback {
+			back = maxCronLookback
+		}
+		cur = s.Next(t.Add(-back))
+		if !cur.IsZero() && !cur.After(t) {
+			break
+		}
+		if back == maxCronLookback {
+			return time.Time{}, false
+		}
+	}
 
-	// Move forward until the next boundary is >= t
+	// Walk forward to the last boundary not after t.
 	for {
 		next := s.Next(cur)
-		if !next.Before(t) {
-			return cur
+		if next.IsZero() || next.After(t) {
+			return cur, true
 		}
 		cur = next
 	}
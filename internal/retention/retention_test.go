@@ -0,0 +1,232 @@
+package retention
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+)
+
+func TestPrevCron(t *testing.T) {
+	utc := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name string
+		rule Rule
+		at   string
+		want string // "" when the schedule has no boundary
+	}{
+		{"hourly", Rule{Cron: "0 * * * *"}, "2026-03-10T14:37:00Z", "2026-03-10T14:00:00Z"},
+		{"hourly on the boundary", Rule{Cron: "0 * * * *"}, "2026-03-10T14:00:00Z", "2026-03-10T14:00:00Z"},
+		{"daily", Rule{Cron: "0 0 * * *"}, "2026-03-10T23:59:59Z", "2026-03-10T00:00:00Z"},
+		{"weekly, days back", Rule{Cron: "0 0 * * 0"}, "2026-03-14T10:00:00Z", "2026-03-08T00:00:00Z"},
+		{"monthly, weeks back", Rule{Cron: "0 0 1 * *"}, "2026-03-31T23:59:00Z", "2026-03-01T00:00:00Z"},
+		{"yearly, months back", Rule{Cron: "0 0 1 1 *"}, "2026-12-31T12:00:00Z", "2026-01-01T00:00:00Z"},
+		{"leap day, years back", Rule{Cron: "0 0 29 2 *"}, "2027-06-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+		{"never fires", Rule{Cron: "0 0 30 2 *"}, "2026-03-10T00:00:00Z", ""},
+
+		// Europe/Berlin is UTC+1 (CET), UTC+2 (CEST) from 2026-03-29 01:00Z
+		// to 2026-10-25 01:00Z.
+		{"daily in a zone", Rule{Cron: "0 0 * * *", Timezone: "Europe/Berlin"}, "2026-03-10T22:30:00Z", "2026-03-09T23:00:00Z"},
+		{"CRON_TZ prefix", Rule{Cron: "CRON_TZ=Europe/Berlin 0 0 * * *"}, "2026-03-10T22:30:00Z", "2026-03-09T23:00:00Z"},
+		{"weekly in a zone", Rule{Cron: "0 0 * * 1", Timezone: "Europe/Berlin"}, "2026-03-08T23:30:00Z", "2026-03-08T23:00:00Z"},
+		{"spring forward, hourly", Rule{Cron: "0 * * * *", Timezone: "Europe/Berlin"}, "2026-03-29T01:30:00Z", "2026-03-29T01:00:00Z"},
+		{"spring forward, daily after", Rule{Cron: "0 0 * * *", Timezone: "Europe/Berlin"}, "2026-03-29T23:30:00Z", "2026-03-29T22:00:00Z"},
+		{"spring forward, daily before", Rule{Cron: "0 0 * * *", Timezone: "Europe/Berlin"}, "2026-03-29T21:59:00Z", "2026-03-28T23:00:00Z"},
+		{"fall back, daily after", Rule{Cron: "0 0 * * *", Timezone: "Europe/Berlin"}, "2026-10-25T23:30:00Z", "2026-10-25T23:00:00Z"},
+		{"fall back, daily before", Rule{Cron: "0 0 * * *", Timezone: "Europe/Berlin"}, "2026-10-25T22:59:00Z", "2026-10-24T22:00:00Z"},
+		{"fall back, hourly in the repeated hour", Rule{Cron: "0 * * * *", Timezone: "Europe/Berlin"}, "2026-10-25T01:30:00Z", "2026-10-25T01:00:00Z"},
+		{"zone of t is ignored", Rule{Cron: "0 0 * * *"}, "2026-03-10T01:30:00+05:00", "2026-03-09T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := tt.rule.schedule()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := prevCron(sched, utc(tt.at))
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("prevCron = %s, want no boundary", got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("prevCron found no boundary, want %s", tt.want)
+			}
+			if want := utc(tt.want); !got.Equal(want) {
+				t.Fatalf("prevCron = %s, want %s", got.UTC().Format(time.RFC3339), tt.want)
+			}
+			if next := sched.Next(got); !next.After(utc(tt.at)) {
+				t.Fatalf("next boundary %s is not after %s", next.UTC().Format(time.RFC3339), tt.at)
+			}
+		})
+	}
+}
+
+func TestRuleSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"plain", Rule{Cron: "0 0 * * *"}, false},
+		{"timezone", Rule{Cron: "0 0 * * *", Timezone: "America/New_York"}, false},
+		{"spec zone", Rule{Cron: "CRON_TZ=Asia/Tokyo 0 0 * * *"}, false},
+		{"both zones", Rule{Cron: "CRON_TZ=Asia/Tokyo 0 0 * * *", Timezone: "UTC"}, true},
+		{"unknown timezone", Rule{Cron: "0 0 * * *", Timezone: "Mars/Olympus"}, true},
+		{"invalid spec", Rule{Cron: "0 0 * *"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.rule.schedule(); (err != nil) != tt.wantErr {
+				t.Fatalf("schedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyKeeps(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	// hourly returns archives of 1 MiB taken ago hours before now, newest first.
+	hourly := func(ago ...int) []stored {
+		out := make([]stored, len(ago))
+		for i, h := range ago {
+			out[i] = stored{name: fmt.Sprint(h), ts: now.Add(-time.Duration(h) * time.Hour), size: 1 << 20}
+		}
+		return out
+	}
+	protect := func(archives []stored, i int) []stored {
+		archives[i].protected = true
+		return archives
+	}
+	resize := func(archives []stored, size int64) []stored {
+		for i := range archives {
+			archives[i].size = size
+		}
+		return archives
+	}
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		archives []stored
+		want     string // k for kept, - for removed, newest first
+	}{
+		{"count", Rule{Count: 3}, hourly(0, 1, 2, 3, 4), "kkk--"},
+		{"nothing configured", Rule{}, hourly(0, 1), "--"},
+		{"maxAge beats count", Rule{Count: 5, MaxAge: "2h"}, hourly(0, 1, 2, 3, 4), "kkk--"},
+		{"minAge beats maxAge", Rule{MinAge: "3h", MaxAge: "1h"}, hourly(0, 1, 2, 3, 4), "kkk--"},
+		{"minAge beats count", Rule{Count: 1, MinAge: "3h"}, hourly(0, 1, 2, 3, 4), "kkk--"},
+		{"keepWithin of the newest", Rule{Count: 1, KeepWithin: "2h"}, hourly(5, 6, 7, 8, 9), "kkk--"},
+		{"maxAge beats keepWithin", Rule{KeepWithin: "1d", MaxAge: "3h"}, hourly(0, 1, 2, 3, 4, 5), "kkkk--"},
+		{"days and weeks", Rule{KeepWithin: "1w", MaxAge: "8d"}, hourly(0, 24*7, 24*7+1, 24*8+1), "kk--"},
+		{"maxBytes trims the oldest kept", Rule{Count: 5, MaxMB: 3}, hourly(0, 1, 2, 3, 4, 5), "kkk---"},
+		{"maxBytes spares minAge", Rule{Count: 5, MinAge: "3h", MaxMB: 1}, hourly(0, 1, 2, 3, 4), "kkk--"},
+		{"maxBytes spares the newest", Rule{Count: 3, MaxMB: 1}, resize(hourly(0, 1, 2), 2<<20), "k--"},
+		{"maxBytes counts protected archives", Rule{Count: 3, MaxMB: 3}, protect(hourly(0, 1, 2, 3, 4, 5), 5), "kk----"},
+		{"maxBytes leaves protected archives", Rule{Count: 2, MaxMB: 1}, protect(hourly(0, 1, 2), 1), "kk-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.rule.policy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keepString(p.keeps(tt.archives, now)); got != tt.want {
+				t.Fatalf("keeps = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarKeeps(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	at := func(stamps ...string) []stored {
+		out := make([]stored, len(stamps))
+		for i, s := range stamps {
+			ts, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[i] = stored{name: s, ts: ts, size: 1 << 20}
+		}
+		return out
+	}
+	sixHourly := at(
+		"2026-03-10T12:00:00Z", "2026-03-10T06:00:00Z", "2026-03-10T00:00:00Z",
+		"2026-03-09T18:00:00Z", "2026-03-09T12:00:00Z",
+		"2026-03-08T18:00:00Z", "2026-03-07T18:00:00Z",
+	)
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		archives []stored
+		want     string
+	}{
+		{"daily", Rule{KeepDaily: 3}, sixHourly, "k--k-k-"},
+		{"hourly", Rule{KeepHourly: 2}, sixHourly, "kk-----"},
+		{"daily and keepLast", Rule{Count: 2, KeepDaily: 3}, sixHourly, "kk-k-k-"},
+		{"maxAge frees buckets", Rule{KeepDaily: 3, MaxAge: "36h"}, sixHourly, "k--k---"},
+		{"minAge beats buckets", Rule{KeepDaily: 1, MinAge: "7h"}, sixHourly, "kk-----"},
+		{"maxBytes trims buckets", Rule{KeepDaily: 4, MaxMB: 2}, sixHourly, "k--k---"},
+		// 2026-03-09T23:30Z is 00:30 on the 10th in Berlin.
+		{"daily in a zone", Rule{KeepDaily: 2, Timezone: "Europe/Berlin"},
+			at("2026-03-10T06:00:00Z", "2026-03-09T23:30:00Z", "2026-03-09T22:30:00Z", "2026-03-09T12:00:00Z"), "k-k-"},
+		{"daily in UTC", Rule{KeepDaily: 2},
+			at("2026-03-10T06:00:00Z", "2026-03-09T23:30:00Z", "2026-03-09T22:30:00Z", "2026-03-09T12:00:00Z"), "kk--"},
+		// ISO week 1 of 2026 starts on Monday 2025-12-29.
+		{"weekly across the year", Rule{KeepWeekly: 2},
+			at("2026-01-04T00:00:00Z", "2025-12-29T00:00:00Z", "2025-12-28T00:00:00Z", "2025-12-22T00:00:00Z"), "k-k-"},
+		{"monthly and yearly", Rule{KeepMonthly: 2, KeepYearly: 2},
+			at("2026-03-01T00:00:00Z", "2026-02-15T00:00:00Z", "2026-02-01T00:00:00Z", "2025-12-31T00:00:00Z", "2025-06-01T00:00:00Z", "2024-12-31T00:00:00Z"), "kk-k--"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.rule.policy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keepString(p.keeps(tt.archives, now)); got != tt.want {
+				t.Fatalf("keeps = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func keepString(keep []bool) string {
+	b := make([]byte, len(keep))
+	for i, k := range keep {
+		b[i] = '-'
+		if k {
+			b[i] = 'k'
+		}
+	}
+	return string(b)
+}
+
+func TestUpdateConfigDropsMetrics(t *testing.T) {
+	r := New(logging.NewSlogLogger(logging.Config{}))
+	r.UpdateConfig(Config{Target: "a", Rules: []Rule{{Name: "snapshots"}, {Name: "daily"}}})
+	storedBytes.Set(3, "a")
+	archiveBytes.Set(1, "a", "snapshots")
+	archiveBytes.Set(2, "a", "daily")
+
+	r.UpdateConfig(Config{Target: "a", Rules: []Rule{{Name: "snapshots"}}})
+	if archiveBytes.Value("a", "snapshots") != 1 || archiveBytes.Value("a", "daily") != 0 || storedBytes.Value("a") != 3 {
+		t.Fatal("removing a rule must drop only its series")
+	}
+
+	r.Forget()
+	if archiveBytes.Value("a", "snapshots") != 0 || storedBytes.Value("a") != 0 {
+		t.Fatal("Forget must drop the series of the target")
+	}
+}
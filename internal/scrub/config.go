@@ -0,0 +1,47 @@
+package scrub
+
+import "time"
+
+const (
+	ActionQuarantine = "quarantine"
+	ActionReport     = "report"
+)
+
+// minInterval is the shortest accepted interval; a pass re-reads every archive.
+const minInterval = 10 * time.Minute
+
+// Config schedules the background re-reading of stored archives.
+type Config struct {
+	Enabled    bool   `yaml:"enabled"`
+	Interval   string `yaml:"interval"`   // between the starts of two passes; at least minInterval
+	StartDelay string `yaml:"startDelay"` // before the first pass after startup
+	RateMB     int    `yaml:"rateMB"`     // MB read per second, across all targets
+	Action     string `yaml:"action"`     // "quarantine" | "report": what happens to corrupt archives
+}
+
+func (c *Config) ApplyDefaults() {
+	if d, err := time.ParseDuration(c.Interval); c.Interval == "" || err != nil || d <= 0 {
+		c.Interval = "24h"
+	} else if d < minInterval {
+		c.Interval = minInterval.String()
+	}
+	if _, err := time.ParseDuration(c.StartDelay); c.StartDelay == "" || err != nil {
+		c.StartDelay = "5m"
+	}
+	if c.RateMB <= 0 {
+		c.RateMB = 20
+	}
+	if c.Action != ActionReport {
+		c.Action = ActionQuarantine
+	}
+}
+
+func (c *Config) interval() time.Duration {
+	d, _ := time.ParseDuration(c.Interval)
+	return d
+}
+
+func (c *Config) startDelay() time.Duration {
+	d, _ := time.ParseDuration(c.StartDelay)
+	return d
+}
@@ -0,0 +1,81 @@
+package scrub
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+)
+
+// maxRead bounds a single throttled read, so pauses stay short.
+const maxRead = 256 << 10
+
+// limiter paces reads to rate bytes per second.
+type limiter struct {
+	rate float64
+	mu   sync.Mutex
+	next time.Time // when the bytes granted so far are due
+}
+
+func newLimiter(rate int64) *limiter {
+	return &limiter{rate: float64(rate)}
+}
+
+// wait blocks until n more bytes fit the rate.
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	d := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// countingFS throttles and counts the bytes read through Open.
+type countingFS struct {
+	fs.FS
+	ctx context.Context
+	lim *limiter
+	n   int64
+}
+
+func (c *countingFS) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := c.FS.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &throttledReader{ReadCloser: rc, fs: c}, nil
+}
+
+type throttledReader struct {
+	io.ReadCloser
+	fs *countingFS
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > maxRead {
+		p = p[:maxRead]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.fs.n += int64(n)
+	if werr := r.fs.lim.wait(r.fs.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
@@ -0,0 +1,19 @@
+package scrub
+
+import "github.com/raoulx24/rdb-archiver/internal/metrics"
+
+var archivesScrubbed = metrics.NewCounter(
+	"rdb_archiver_scrub_archives_total",
+	"Archives re-read by the scrubber, by result (ok, corrupt, error).",
+	"result",
+)
+
+var bytesScrubbed = metrics.NewCounter(
+	"rdb_archiver_scrub_bytes_total",
+	"Stored archive bytes read by the scrubber.",
+)
+
+var archivesQuarantined = metrics.NewCounter(
+	"rdb_archiver_scrub_quarantined_total",
+	"Corrupt archives moved into quarantine by the scrubber.",
+)
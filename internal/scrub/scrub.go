@@ -0,0 +1,303 @@
+// Package scrub periodically re-reads every stored archive, so corruption on
+// the destination is found long before a restore needs the archive. Archives
+// failing verification are moved into the quarantine folder, where retention
+// neither counts nor removes them.
+package scrub
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/catalog"
+	"github.com/raoulx24/rdb-archiver/internal/crypt"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+	"github.com/raoulx24/rdb-archiver/internal/verify"
+	"github.com/raoulx24/rdb-archiver/internal/worker"
+)
+
+const (
+	// maxFindings bounds the corrupt archives kept in Status.
+	maxFindings = 50
+	// settleTime skips archives modified this recently, as their manifest
+	// sidecar is written after them.
+	settleTime = 10 * time.Minute
+)
+
+// Status reports the scrubber progress for the health endpoint.
+type Status struct {
+	Enabled    bool      `json:"enabled"`
+	Running    bool      `json:"running"`
+	LastStart  time.Time `json:"lastStart"`
+	LastFinish time.Time `json:"lastFinish"`
+	NextRun    time.Time `json:"nextRun"`
+	Current    Pass      `json:"current"`  // the running pass
+	LastPass   Pass      `json:"lastPass"` // the latest finished pass
+	// Corrupt lists the latest corrupt archives found, oldest first.
+	Corrupt []Finding `json:"corrupt,omitempty"`
+}
+
+// Pass counts the archives of one pass over all targets.
+type Pass struct {
+	Archives int   `json:"archives"`
+	OK       int   `json:"ok"`
+	Corrupt  int   `json:"corrupt"`
+	Errors   int   `json:"errors"` // archives that could not be read
+	Bytes    int64 `json:"bytes"`
+}
+
+// Finding is one archive that failed verification.
+type Finding struct {
+	Time        time.Time `json:"time"`
+	Target      string    `json:"target"`
+	Archive     string    `json:"archive"`
+	Error       string    `json:"error"`
+	Quarantined string    `json:"quarantined,omitempty"` // new location
+}
+
+// Scrubber verifies the archives of all destination targets at a bounded rate.
+type Scrubber struct {
+	mu     sync.RWMutex
+	cfg    Config
+	dest   worker.Config
+	local  *fs.OSFS
+	logg   logging.Logger
+	status Status
+	reload chan struct{}
+}
+
+// New creates a scrubber for the targets of dest.
+func New(cfg Config, dest worker.Config, local *fs.OSFS, log logging.Logger) *Scrubber {
+	return &Scrubber{
+		cfg:    cfg,
+		dest:   dest,
+		local:  local,
+		logg:   log.With("pkg", "scrub"),
+		status: Status{Enabled: cfg.Enabled},
+		reload: make(chan struct{}, 1),
+	}
+}
+
+// UpdateConfig applies new settings; a changed schedule takes effect at once,
+// a running pass finishes with its targets.
+func (s *Scrubber) UpdateConfig(cfg Config, dest worker.Config) {
+	s.mu.Lock()
+	s.cfg, s.dest = cfg, dest
+	s.status.Enabled = cfg.Enabled
+	s.mu.Unlock()
+
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns a copy of the scrubber status.
+func (s *Scrubber) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := s.status
+	st.Corrupt = append([]Finding(nil), s.status.Corrupt...)
+	return st
+}
+
+// Start runs passes every Interval until ctx is done.
+func (s *Scrubber) Start(ctx context.Context) {
+	s.mu.RLock()
+	next := time.Now().Add(s.cfg.startDelay())
+	s.mu.RUnlock()
+
+	for {
+		s.mu.Lock()
+		enabled := s.cfg.Enabled
+		if enabled {
+			s.status.NextRun = next
+		} else {
+			s.status.NextRun = time.Time{}
+		}
+		s.mu.Unlock()
+
+		// A nil channel blocks: while disabled only a reload wakes the loop.
+		var (
+			t     *time.Timer
+			timer <-chan time.Time
+		)
+		if enabled {
+			t = time.NewTimer(time.Until(next))
+			timer = t.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if t != nil {
+				t.Stop()
+			}
+			s.logg.Info("scrubber stopped")
+			return
+		case <-s.reload:
+			if t != nil {
+				t.Stop()
+			}
+			// Re-plan the pending run from the new interval.
+			s.mu.RLock()
+			if !s.status.LastStart.IsZero() {
+				next = s.status.LastStart.Add(s.cfg.interval())
+			}
+			s.mu.RUnlock()
+		case <-timer:
+			start := time.Now()
+			s.run(ctx)
+			s.mu.RLock()
+			next = start.Add(s.cfg.interval())
+			s.mu.RUnlock()
+		}
+	}
+}
+
+// run makes one pass over every target.
+func (s *Scrubber) run(ctx context.Context) {
+	s.mu.Lock()
+	cfg, dest := s.cfg, s.dest
+	s.status.Running = true
+	s.status.LastStart = time.Now()
+	s.status.Current = Pass{}
+	s.mu.Unlock()
+
+	s.logg.Info("scrub pass started", "rateMB", cfg.RateMB)
+	lim := newLimiter(int64(cfg.RateMB) << 20)
+
+	var pub ed25519.PublicKey
+	if path := dest.Signing.VerifyKeyFile(); path != "" {
+		var err error
+		if pub, err = manifest.LoadPublicKey(path); err != nil {
+			s.logg.Error("loading signature key failed, signatures are not checked", "error", err)
+		}
+	}
+
+	for _, tc := range dest.TargetConfigs() {
+		if ctx.Err() != nil {
+			break
+		}
+		s.scrubTarget(ctx, cfg, tc, pub, lim)
+	}
+
+	s.mu.Lock()
+	s.status.Running = false
+	s.status.LastFinish = time.Now()
+	s.status.LastPass = s.status.Current
+	pass := s.status.LastPass
+	s.mu.Unlock()
+
+	s.logg.Info("scrub pass finished", "archives", pass.Archives, "ok", pass.OK,
+		"corrupt", pass.Corrupt, "errors", pass.Errors, "bytes", pass.Bytes)
+}
+
+func (s *Scrubber) scrubTarget(ctx context.Context, cfg Config, tc worker.TargetConfig, pub ed25519.PublicKey, lim *limiter) {
+	logg := s.logg.With("target", tc.Name)
+
+	dst, err := fs.Open(tc.Backend, tc.S3, s.local)
+	if err != nil {
+		logg.Error("invalid destination", "error", err)
+		return
+	}
+	keys, err := crypt.LoadKeys(tc.Encryption)
+	if err != nil {
+		logg.Warn("loading decryption keys failed, sealed archives are only checked as stored", "error", err)
+		keys = nil
+	}
+
+	root := filepath.Join(tc.Root, tc.SubDir)
+	entries, err := catalog.List(ctx, dst, root)
+	if err != nil {
+		logg.Error("listing archives failed", "error", err)
+		return
+	}
+
+	counted := &countingFS{FS: dst, ctx: ctx, lim: lim}
+	v := verify.New(counted, keys, pub)
+	for _, e := range entries {
+		if e.Rule == worker.QuarantineSubdir || time.Since(e.ModTime) < settleTime {
+			continue
+		}
+		counted.n = 0
+		res, err := v.Verify(ctx, e.Path)
+		if ctx.Err() != nil {
+			return
+		}
+		bytesScrubbed.Add(float64(counted.n))
+
+		switch {
+		case err == nil:
+			archivesScrubbed.Inc("ok")
+			logg.Debug("archive verified", "archive", e.Path, "members", res.Members, "notes", res.Notes)
+			s.record(counted.n, func(p *Pass) { p.OK++ })
+
+		case errors.Is(err, verify.ErrCorrupt) && changed(ctx, dst, e):
+			logg.Debug("archive changed during scrub", "archive", e.Path)
+
+		case errors.Is(err, verify.ErrCorrupt):
+			archivesScrubbed.Inc("corrupt")
+			logg.Error("corrupt archive found", "archive", e.Path, "error", err)
+			f := Finding{Time: time.Now(), Target: tc.Name, Archive: e.Path, Error: err.Error()}
+			if cfg.Action == ActionQuarantine {
+				f.Quarantined = s.quarantine(ctx, logg, dst, root, e)
+			}
+			s.record(counted.n, func(p *Pass) { p.Corrupt++ })
+			s.addFinding(f)
+
+		case errors.Is(err, os.ErrNotExist):
+			// Removed by retention since it was listed.
+			logg.Debug("archive vanished during scrub", "archive", e.Path)
+
+		default:
+			archivesScrubbed.Inc("error")
+			logg.Warn("reading archive failed", "archive", e.Path, "error", err)
+			s.record(counted.n, func(p *Pass) { p.Errors++ })
+		}
+	}
+}
+
+// quarantine moves a corrupt archive with its sidecar and signature into
+// <root>/quarantine/<rule>/. It returns the new archive path, or "" when the
+// archive could not be moved.
+func (s *Scrubber) quarantine(ctx context.Context, logg logging.Logger, dst fs.FS, root string, e catalog.Entry) string {
+	target, err := worker.Quarantine(ctx, logg, dst, root, e.Rule, e.Path)
+	if err != nil {
+		logg.Error("quarantining archive failed", "archive", e.Path, "error", err)
+		return ""
+	}
+
+	archivesQuarantined.Inc()
+	logg.Warn("archive quarantined", "archive", e.Path, "quarantine", target)
+	return target
+}
+
+// changed reports whether the archive was replaced or removed since listed.
+func changed(ctx context.Context, dst fs.FS, e catalog.Entry) bool {
+	st, err := dst.Stat(ctx, e.Path)
+	// Listings and stat calls of object stores differ in precision.
+	return err != nil || st.Size != e.Size || !st.MTime.Truncate(time.Second).Equal(e.ModTime.Truncate(time.Second))
+}
+
+func (s *Scrubber) record(n int64, count func(*Pass)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Current.Archives++
+	s.status.Current.Bytes += n
+	count(&s.status.Current)
+}
+
+func (s *Scrubber) addFinding(f Finding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Corrupt = append(s.status.Corrupt, f)
+	if n := len(s.status.Corrupt); n > maxFindings {
+		s.status.Corrupt = append([]Finding(nil), s.status.Corrupt[n-maxFindings:]...)
+	}
+}
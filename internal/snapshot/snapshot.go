@@ -3,14 +3,55 @@ package snapshot
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/aof"
 )
 
+// TimestampLayout names archives; it sorts lexically and is safe in paths.
+const TimestampLayout = "2006-01-02T15-04-05"
+
 // Snapshot represents a single archived snapshot file.
 type Snapshot struct {
-	Dir     string
-	Primary Artifact
-	Aux     []Artifact
+	Dir        string
+	Primary    Artifact
+	Aux        []Artifact
+	DetectedAt time.Time // when the watcher picked the snapshot up
+	Capture    *Capture  // capture policy outcome; nil when no policy applied
+	Mode       string    // "rdb", or "aof" when Primary is an AOF manifest
+	AOF        *aof.Manifest
+}
+
+// RDB returns the RDB file of the snapshot: the primary in rdb mode, the
+// base file in aof mode when the base is in RDB format.
+func (s Snapshot) RDB() (Artifact, bool) {
+	if s.Mode != "aof" {
+		return s.Primary, true
+	}
+	if s.AOF == nil {
+		return Artifact{}, false
+	}
+	for _, f := range s.AOF.Files {
+		if f.Type != aof.TypeBase || !strings.HasSuffix(f.Name, ".rdb") {
+			continue
+		}
+		for _, a := range s.Aux {
+			if filepath.Base(a.Name) == f.Name {
+				return a, true
+			}
+		}
+	}
+	return Artifact{}, false
+}
+
+// Capture records how the capture policy judged a snapshot.
+type Capture struct {
+	Policy string `json:"policy"`
+	Role   string `json:"role"` // node role from nodes.conf
+	NodeID string `json:"nodeId"`
+	Tagged bool   `json:"tagged"` // archived although the policy excludes this node
+	Reason string `json:"reason"`
 }
 
 // Job wraps a snapshot for mailbox delivery.
@@ -20,9 +61,10 @@ type Job struct {
 
 // Artifact describes a single file within a snapshot
 type Artifact struct {
-	Name    string
+	Name    string // relative to Snapshot.Dir
 	Size    int64
 	ModTime time.Time
+	Growing bool // appended to while archived; only the first Size bytes are captured
 }
 
 // FromFileInfo constructs an Artifact from a file path and os.FileInfo.
@@ -33,3 +75,13 @@ func FromFileInfo(path string, info os.FileInfo) Artifact {
 		Size:    info.Size(),
 	}
 }
+
+// FormatTimestamp returns the archive name for t, in UTC.
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(TimestampLayout)
+}
+
+// ParseTimestamp parses an archive name produced by FormatTimestamp.
+func ParseTimestamp(name string) (time.Time, error) {
+	return time.Parse(TimestampLayout, name)
+}
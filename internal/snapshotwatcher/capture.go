@@ -0,0 +1,103 @@
+package snapshotwatcher
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/raoulx24/rdb-archiver/internal/cluster"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+// capture applies the capture policy to snap and reports whether it should be
+// archived. Whenever the node's role cannot be determined the snapshot is
+// archived: a redundant backup is cheaper than a missing one.
+func (sw *Watcher) capture(snap *snapshot.Snapshot, policy Capture) bool {
+	if policy.Policy == "all" {
+		return true
+	}
+
+	var nodesFile string
+	for _, a := range snap.Aux {
+		if cluster.IsNodesFile(a.Name) {
+			nodesFile = filepath.Join(snap.Dir, a.Name)
+			break
+		}
+	}
+	if nodesFile == "" {
+		sw.logg.Debug("no cluster config among aux files, capturing snapshot", "policy", policy.Policy)
+		captureDecisions.Inc(policy.Policy, "archive")
+		return true
+	}
+
+	topo, err := cluster.ParseNodesFile(nodesFile)
+	if err != nil || topo.Myself == nil {
+		sw.logg.Warn("cannot determine cluster role, capturing snapshot", "path", nodesFile, "error", err)
+		captureDecisions.Inc(policy.Policy, "archive")
+		return true
+	}
+
+	me := topo.Myself
+	c := &snapshot.Capture{Policy: policy.Policy, Role: me.Role, NodeID: me.ID}
+	include, reason := decideCapture(topo, policy.Policy)
+	c.Reason = reason
+	snap.Capture = c
+
+	switch {
+	case include:
+		sw.logg.Info("capturing snapshot", "policy", policy.Policy, "role", me.Role, "node", me.ID, "reason", reason)
+		captureDecisions.Inc(policy.Policy, "archive")
+		return true
+	case policy.ReplicaAction == "tag":
+		c.Tagged = true
+		sw.logg.Info("capturing tagged replica snapshot", "policy", policy.Policy, "role", me.Role, "node", me.ID, "reason", reason)
+		captureDecisions.Inc(policy.Policy, "tag")
+		return true
+	}
+
+	sw.logg.Info("skipping replica snapshot", "policy", policy.Policy, "role", me.Role, "node", me.ID, "reason", reason)
+	captureDecisions.Inc(policy.Policy, "skip")
+	return false
+}
+
+// decideCapture reports whether the policy includes the myself node. With
+// primariesAndOneReplica every replica of a shard elects the same one: the
+// healthy replica with the lowest node ID.
+func decideCapture(topo *cluster.Topology, policy string) (bool, string) {
+	me := topo.Myself
+	switch {
+	case me.Role == cluster.RoleMaster:
+		return true, "primary"
+	case me.Role != cluster.RoleReplica:
+		return true, "unknown role"
+	case policy == "primaries":
+		return false, "replica"
+	case policy != "primariesAndOneReplica":
+		return true, "unknown policy " + policy
+	}
+
+	designated := ""
+	for _, n := range topo.Nodes {
+		if n.Role != cluster.RoleReplica || n.MasterID != me.MasterID || !healthy(n) {
+			continue
+		}
+		if designated == "" || n.ID < designated {
+			designated = n.ID
+		}
+	}
+	if designated == me.ID {
+		return true, "designated replica of " + me.MasterID
+	}
+	return false, "replica " + designated + " is designated for " + me.MasterID
+}
+
+func healthy(n cluster.Node) bool {
+	if n.LinkState != "connected" {
+		return false
+	}
+	for _, bad := range []string{"fail", "fail?", "noaddr", "handshake"} {
+		if slices.Contains(n.Flags, bad) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,10 +1,39 @@
 ﻿package snapshotwatcher
 
+import (
+	"path/filepath"
+
+	"github.com/raoulx24/rdb-archiver/internal/aof"
+)
+
 type Config struct {
 	Path        string   `yaml:"path"`
 	PrimaryName string   `yaml:"primaryName"`
 	AuxNames    []string `yaml:"auxNames"`
 	WatchMode   string   `yaml:"watchMode"`
+	Capture     Capture  `yaml:"capture"`
+
+	// Mode "aof" archives a Redis 7+ multi-part AOF directory instead of
+	// PrimaryName: the watcher follows the AOF manifest and captures every
+	// file it lists.
+	Mode           string `yaml:"mode"`           // "rdb" | "aof"
+	AppendDirName  string `yaml:"appendDirName"`  // redis appenddirname
+	AppendFilename string `yaml:"appendFilename"` // redis appendfilename
+}
+
+// watchTarget returns the directory and file the watcher follows.
+func (c *Config) watchTarget() (dir, file string) {
+	if c.Mode == "aof" {
+		return filepath.Join(c.Path, c.AppendDirName), c.AppendFilename + aof.ManifestSuffix
+	}
+	return c.Path, c.PrimaryName
+}
+
+// Capture decides, from the myself line of nodes.conf, whether a cluster node
+// archives its snapshots. Nodes outside a cluster always archive.
+type Capture struct {
+	Policy        string `yaml:"policy"`        // "all" | "primaries" | "primariesAndOneReplica"
+	ReplicaAction string `yaml:"replicaAction"` // "skip" | "tag": what to do with excluded replicas
 }
 
 func (c *Config) ApplyDefaults() {
@@ -17,5 +46,20 @@ func (c *Config) ApplyDefaults() {
 	if c.WatchMode == "" {
 		c.WatchMode = "fsnotify" // "auto" | "fsnotify" | "poll"
 	}
+	if c.Mode == "" {
+		c.Mode = "rdb"
+	}
+	if c.AppendDirName == "" {
+		c.AppendDirName = "appendonlydir"
+	}
+	if c.AppendFilename == "" {
+		c.AppendFilename = "appendonly.aof"
+	}
+	if c.Capture.Policy == "" {
+		c.Capture.Policy = "all"
+	}
+	if c.Capture.ReplicaAction == "" {
+		c.Capture.ReplicaAction = "skip"
+	}
 	// AuxNames can stay empty; no default needed.
 }
@@ -3,6 +3,7 @@
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/raoulx24/rdb-archiver/internal/snapshot"
 )
@@ -10,12 +11,12 @@ import (
 // checkForNewSnapshot checks for a new snapshot and emits a job if needed.
 func (sw *Watcher) checkForNewSnapshot() {
 	sw.mu.RLock()
-	dir := sw.cfg.Path
-	primary := sw.cfg.PrimaryName
+	cfg := sw.cfg
 	aux := append([]string(nil), sw.cfg.AuxNames...)
 	sw.mu.RUnlock()
 
-	path := filepath.Join(dir, primary)
+	watchDir, file := cfg.watchTarget()
+	path := filepath.Join(watchDir, file)
 
 	info, err := os.Stat(path)
 	if err != nil {
@@ -25,15 +26,24 @@ func (sw *Watcher) checkForNewSnapshot() {
 	mod := info.ModTime()
 
 	snap := snapshot.Snapshot{
-		Dir:     dir,
-		Primary: snapshot.FromFileInfo(path, info),
-		Aux:     sw.loadAux(dir, aux),
+		Dir:        cfg.Path,
+		Primary:    snapshot.FromFileInfo(path, info),
+		Mode:       "rdb",
+		DetectedAt: time.Now(),
 	}
+	if cfg.Mode == "aof" && !sw.loadAOF(&snap, cfg.AppendDirName, path, info) {
+		return
+	}
+	snap.Aux = append(snap.Aux, sw.loadAux(cfg.Path, aux)...)
 
 	sw.mu.Lock()
 	sw.lastModTime = mod
 	sw.mu.Unlock()
 
 	sw.logg.Info("snapshot detected", "path", path)
+	snapshotsDetected.Inc()
+	if !sw.capture(&snap, cfg.Capture) {
+		return
+	}
 	sw.mb.Put(snapshot.Job{Snap: snap})
 }
@@ -0,0 +1,49 @@
+package snapshotwatcher
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/raoulx24/rdb-archiver/internal/aof"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+// loadAOF fills snap with the AOF manifest and the base and incr files it
+// lists. Names stay relative to the data dir so the archive keeps the
+// appendonlydir layout. It returns false when the manifest and the files do
+// not agree, as happens while a rewrite switches files; the next event retries.
+func (sw *Watcher) loadAOF(snap *snapshot.Snapshot, aofDir, manifestPath string, info os.FileInfo) bool {
+	m, err := aof.ParseManifestFile(manifestPath)
+	if err != nil {
+		sw.logg.Warn("reading aof manifest failed", "path", manifestPath, "error", err)
+		return false
+	}
+
+	snap.Mode = "aof"
+	snap.AOF = m
+	snap.Primary.Name = filepath.Join(aofDir, filepath.Base(manifestPath))
+
+	active, hasActive := m.Active()
+	for _, f := range m.Live() {
+		name := filepath.Join(aofDir, f.Name)
+		st, err := os.Stat(filepath.Join(snap.Dir, name))
+		if err != nil {
+			sw.logg.Warn("aof file listed in manifest is missing, waiting for the next change", "file", name, "error", err)
+			return false
+		}
+		snap.Aux = append(snap.Aux, snapshot.Artifact{
+			Name:    name,
+			Size:    st.Size(),
+			ModTime: st.ModTime(),
+			Growing: hasActive && f == active,
+		})
+	}
+
+	// A rewrite may have replaced the manifest while its files were listed.
+	st, err := os.Stat(manifestPath)
+	if err != nil || !st.ModTime().Equal(info.ModTime()) || st.Size() != info.Size() {
+		sw.logg.Debug("aof manifest changed while capturing, waiting for the next change", "path", manifestPath)
+		return false
+	}
+	return true
+}
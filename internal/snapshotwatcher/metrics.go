@@ -0,0 +1,14 @@
+package snapshotwatcher
+
+import "github.com/raoulx24/rdb-archiver/internal/metrics"
+
+var snapshotsDetected = metrics.NewCounter(
+	"rdb_archiver_snapshots_detected_total",
+	"New snapshots detected in the source directory.",
+)
+
+var captureDecisions = metrics.NewCounter(
+	"rdb_archiver_capture_decisions_total",
+	"Capture policy decisions for detected snapshots, by policy and decision (archive, tag, skip).",
+	"policy", "decision",
+)
@@ -11,5 +11,8 @@ func (sw *Watcher) UpdateConfig(cfg Config) {
 func (sw *Watcher) NeedsRestart(oldCfg, newCfg Config) bool {
 	return oldCfg.WatchMode != newCfg.WatchMode ||
 		oldCfg.Path != newCfg.Path ||
-		oldCfg.PrimaryName != newCfg.PrimaryName
+		oldCfg.PrimaryName != newCfg.PrimaryName ||
+		oldCfg.Mode != newCfg.Mode ||
+		oldCfg.AppendDirName != newCfg.AppendDirName ||
+		oldCfg.AppendFilename != newCfg.AppendFilename
 }
@@ -55,8 +55,7 @@ func (sw *Watcher) Start(ctx context.Context) error {
 	go sw.consumeEvents(ctx, events)
 
 	sw.mu.RLock()
-	dir := sw.cfg.Path
-	file := sw.cfg.PrimaryName
+	dir, file := sw.cfg.watchTarget()
 	mode := sw.cfg.WatchMode
 	sw.mu.RUnlock()
 
@@ -0,0 +1,291 @@
+// Package verify re-checks archives against the checksums and signature in
+// their manifest sidecar, and the RDB files they contain against their CRC64.
+package verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/raoulx24/rdb-archiver/internal/crypt"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+	"github.com/raoulx24/rdb-archiver/internal/rdb"
+)
+
+// ErrCorrupt marks integrity failures: a checksum, size or signature that
+// does not match, an archive that does not decode or an invalid RDB file. Other errors come from
+// reading the destination and say nothing about the archive itself.
+var ErrCorrupt = errors.New("archive corrupt")
+
+// Result describes what was checked for one archive.
+type Result struct {
+	Archive  string
+	Manifest bool   // a sidecar with checksums was found
+	SignedBy string // key ID of a verified signature
+	Members  int    // members decoded and, with a manifest, compared
+	RDBs     int    // .rdb members whose structure and CRC64 were validated
+	Decoded  bool   // the archive was read to the end; false for sealed archives without keys
+	Notes    []string
+}
+
+// Verifier checks archives stored on one destination.
+type Verifier struct {
+	src  fs.FS
+	keys *crypt.Keys
+	pub  ed25519.PublicKey
+}
+
+// New creates a verifier reading from src. keys opens sealed archives and may
+// be nil; pub verifies sidecar signatures and may be nil when unsigned.
+func New(src fs.FS, keys *crypt.Keys, pub ed25519.PublicKey) *Verifier {
+	return &Verifier{src: src, keys: keys, pub: pub}
+}
+
+// Verify checks the sidecar signature, then streams archive once, comparing
+// the stored bytes and every member with the recorded checksums, validating
+// RDB members and matching the embedded manifest with the sidecar. Archives
+// without a sidecar are only checked to decode.
+func (v *Verifier) Verify(ctx context.Context, archive string) (Result, error) {
+	res := Result{Archive: archive}
+
+	sidecar, err := v.readManifest(ctx, &res)
+	if err != nil {
+		return res, err
+	}
+	var sums *fs.Checksums
+	if sidecar != nil {
+		sums = sidecar.Checksums
+	}
+
+	in, err := v.src.Open(ctx, archive)
+	if err != nil {
+		return res, fmt.Errorf("opening archive: %w", err)
+	}
+	defer in.Close()
+
+	// Hash exactly what is stored; remember read errors so they are not
+	// mistaken for corruption when the decoder fails.
+	src := &sourceReader{r: in}
+	stored := fs.NewHasher()
+	tee := io.TeeReader(src, stored)
+
+	err = v.decode(ctx, tee, archive, sidecar, &res)
+	if src.err != nil {
+		return res, fmt.Errorf("reading archive: %w", src.err)
+	}
+	if err != nil {
+		return res, err
+	}
+	// Anything the decoder left unread still counts towards the stored bytes.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return res, fmt.Errorf("reading archive: %w", err)
+	}
+
+	if sums == nil {
+		return res, nil
+	}
+	got := stored.Digest("")
+	if got.Size != sums.Archive.Size || got.SHA256 != sums.Archive.SHA256 {
+		return res, fmt.Errorf("%w: archive sha256 %s (%d bytes), manifest has %s (%d bytes)",
+			ErrCorrupt, got.SHA256, got.Size, sums.Archive.SHA256, sums.Archive.Size)
+	}
+	return res, nil
+}
+
+// readManifest loads and authenticates the sidecar of res.Archive. It returns
+// nil for archives written before sidecars had checksums.
+func (v *Verifier) readManifest(ctx context.Context, res *Result) (*manifest.Manifest, error) {
+	sidecar := manifest.SidecarPath(res.Archive)
+	data, err := readFile(ctx, v.src, sidecar)
+	if errors.Is(err, os.ErrNotExist) {
+		res.Notes = append(res.Notes, "no manifest sidecar, only decoding")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	sig, err := readFile(ctx, v.src, manifest.SignaturePath(res.Archive))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if v.pub != nil {
+			return nil, fmt.Errorf("%w: manifest is not signed", ErrCorrupt)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("reading signature: %w", err)
+	case v.pub == nil:
+		res.Notes = append(res.Notes, "manifest is signed, no public key to check it")
+	default:
+		if err := manifest.Verify(v.pub, data, sig); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		res.SignedBy = manifest.KeyID(v.pub)
+	}
+
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if m.Checksums == nil {
+		res.Notes = append(res.Notes, "manifest has no checksums, only decoding")
+		return nil, nil
+	}
+	if name := m.Checksums.Archive.Name; name != "" && name != filepath.Base(res.Archive) {
+		return nil, fmt.Errorf("%w: manifest describes %s", ErrCorrupt, name)
+	}
+	res.Manifest = true
+	return m, nil
+}
+
+// decode reads the archive content from r and checks its members against the
+// sidecar, which may be nil.
+func (v *Verifier) decode(ctx context.Context, r io.Reader, archive string, sidecar *manifest.Manifest, res *Result) error {
+	var sums *fs.Checksums
+	if sidecar != nil {
+		sums = sidecar.Checksums
+	}
+	content, codec, _, err := crypt.Open(r, archive, v.keys)
+	if errors.Is(err, crypt.ErrNoKey) {
+		if sums == nil {
+			return err
+		}
+		res.Notes = append(res.Notes, "no decryption key, only the stored bytes are checked")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	var (
+		seen     = make(map[string]bool)
+		embedded []byte
+		crcs     = make(map[string]uint64) // CRC64 trailers of .rdb members
+	)
+	err = fs.ReadCompressedTar(content, codec, func(hdr *tar.Header, body io.Reader) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		h := fs.NewHasher()
+		switch {
+		case hdr.Name == manifest.FileName:
+			var buf bytes.Buffer
+			if _, err := io.Copy(io.MultiWriter(h, &buf), body); err != nil {
+				return err
+			}
+			embedded = buf.Bytes()
+		case strings.HasSuffix(hdr.Name, ".rdb"):
+			rr, err := rdb.Validate(io.TeeReader(body, h))
+			if errors.Is(err, rdb.ErrInvalid) {
+				return fmt.Errorf("%w: member %s: %v", ErrCorrupt, hdr.Name, err)
+			}
+			if err != nil {
+				return err
+			}
+			crcs[hdr.Name] = rr.Checksum
+			res.RDBs++
+		default:
+			if _, err := io.Copy(h, body); err != nil {
+				return err
+			}
+		}
+		res.Members++
+		if sums == nil {
+			return nil
+		}
+		want, ok := sums.Member(hdr.Name)
+		if !ok {
+			return fmt.Errorf("%w: member %s not in manifest", ErrCorrupt, hdr.Name)
+		}
+		if got := h.Digest(hdr.Name); got != want {
+			return fmt.Errorf("%w: member %s sha256 %s (%d bytes), manifest has %s (%d bytes)",
+				ErrCorrupt, hdr.Name, got.SHA256, got.Size, want.SHA256, want.Size)
+		}
+		seen[hdr.Name] = true
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrCorrupt) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if sums != nil {
+		for _, d := range sums.Members {
+			if !seen[d.Name] {
+				return fmt.Errorf("%w: member %s missing from archive", ErrCorrupt, d.Name)
+			}
+		}
+	}
+	if embedded != nil {
+		if err := compareManifests(embedded, sidecar, crcs); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+	}
+	res.Decoded = true
+	return nil
+}
+
+// compareManifests checks the manifest stored in the archive against the
+// sidecar, which is the same document plus checksums, and the RDB checksum it
+// recorded against the one found while decoding.
+func compareManifests(embedded []byte, sidecar *manifest.Manifest, crcs map[string]uint64) error {
+	m, err := manifest.Parse(embedded)
+	if err != nil {
+		return fmt.Errorf("embedded %w", err)
+	}
+	if m.RDB != nil && m.RDB.Checksum != "" && len(m.Files) > 0 {
+		if crc, ok := crcs[m.Files[0].Name]; ok && fmt.Sprintf("%016x", crc) != m.RDB.Checksum {
+			return fmt.Errorf("rdb checksum %016x, manifest has %s", crc, m.RDB.Checksum)
+		}
+	}
+	if sidecar == nil {
+		return nil
+	}
+
+	// Compare both documents as re-encoded by this version.
+	side := *sidecar
+	side.Checksums = nil
+	a, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	b, err := side.Marshal()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(a, b) {
+		return errors.New("sidecar manifest differs from the one in the archive")
+	}
+	return nil
+}
+
+func readFile(ctx context.Context, src fs.FS, path string) ([]byte, error) {
+	r, err := src.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// sourceReader records the first read error of the destination.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/clusterset"
+)
+
+// updateClusterSets assembles the cluster snapshot set around at, stores it and
+// returns the archives retention must keep. ok is false when the stored sets
+// could not be read and protection is on: pruning then might break a set.
+// Set failures never fail the archive itself.
+func (w *Worker) updateClusterSets(ctx context.Context, t *target, at time.Time, clustered bool) (protected map[string]bool, ok bool) {
+	cfg := t.cfg.ClusterSets
+	if !cfg.Enabled {
+		return nil, true
+	}
+	logg := w.logg.With("target", t.cfg.Name)
+
+	if clustered {
+		set, err := clusterset.Assemble(ctx, t.fs, t.cfg.Root, cfg, at)
+		switch {
+		case err != nil:
+			logg.Error("assembling cluster snapshot set failed", "error", err)
+		case set == nil:
+			logg.Debug("no primary snapshots to assemble a cluster set from")
+		default:
+			if err := clusterset.Write(ctx, t.fs, t.cfg.Root, cfg, set); err != nil {
+				logg.Error("writing cluster snapshot set failed", "set", set.ID, "error", err)
+			}
+			clusterSetsAssembled.Inc(strconv.FormatBool(set.Complete))
+
+			if set.Complete {
+				logg.Info("cluster snapshot set complete", "set", set.ID, "members", len(set.Members))
+			} else {
+				stale := make([]string, 0, len(set.Stale))
+				for _, s := range set.Stale {
+					stale = append(stale, s.Host)
+				}
+				logg.Warn("cluster snapshot set incomplete", "set", set.ID, "members", len(set.Members),
+					"missingSlots", set.MissingCount(), "staleHosts", stale)
+			}
+		}
+	}
+
+	sets, err := clusterset.List(ctx, t.fs, t.cfg.Root, cfg)
+	if err != nil {
+		logg.Error("listing cluster snapshot sets failed", "error", err)
+		return nil, !cfg.Protect
+	}
+	if err := clusterset.Prune(ctx, t.fs, t.cfg.Root, cfg, sets); err != nil {
+		logg.Warn("pruning cluster snapshot sets failed", "error", err)
+	}
+	return clusterset.Protected(t.cfg.Root, cfg, sets), true
+}
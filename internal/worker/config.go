@@ -1,21 +1,211 @@
-﻿package worker
+package worker
 
-import "github.com/raoulx24/rdb-archiver/internal/retention"
+import (
+	"fmt"
+	"slices"
+	"time"
 
+	"github.com/raoulx24/rdb-archiver/internal/clusterset"
+	"github.com/raoulx24/rdb-archiver/internal/crypt"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/retention"
+)
+
+// QuarantineSubdir holds archives of snapshots that failed validation.
+// It is never subject to retention.
+const QuarantineSubdir = "quarantine"
+
+// Config describes where snapshots are archived. The top-level target fields
+// describe a single destination; when Targets is set it replaces them and the
+// archive is fanned out to every listed target.
 type Config struct {
-	Root           string          `yaml:"root"`
-	SubDir         string          `yaml:"subDir"`
-	SnapshotSubdir string          `yaml:"snapshotSubdir"`
-	Retention      RetentionConfig `yaml:"retention"`
+	TargetConfig `yaml:",inline"`
+	Targets      []TargetConfig `yaml:"targets"`
+	StagingDir   string         `yaml:"stagingDir"` // local scratch space when no target is local
+	Validation   string         `yaml:"validation"` // "reject" | "quarantine" | "off"
+	// TimestampSource names archives and drives retention buckets:
+	// "mtime" (file modification time), "ctime" (RDB aux field) or "detected".
+	TimestampSource string        `yaml:"timestampSource"`
+	Pin             PinConfig     `yaml:"pin"`
+	Signing         SigningConfig `yaml:"signing"`
+	// Preempt decides what a newer snapshot does to the one being archived:
+	// "finish" completes it first, "cancel" aborts it in favour of the newer one.
+	Preempt   string          `yaml:"preempt"`
+	Reconcile ReconcileConfig `yaml:"reconcile"`
+}
+
+// ReconcileConfig schedules the sweep of the archive tree for leftovers of
+// interrupted writes. A sweep always runs on startup.
+type ReconcileConfig struct {
+	Interval string `yaml:"interval"` // between two sweeps; "0" sweeps on startup only
+	MinAge   string `yaml:"minAge"`   // tmp files and archives modified more recently are left alone; at least minSweepAge
+	Action   string `yaml:"action"`   // "quarantine" | "report": what happens to empty, unreadable or truncated archives
+}
+
+func (c *ReconcileConfig) ApplyDefaults() {
+	if _, err := time.ParseDuration(c.Interval); c.Interval == "" || err != nil {
+		c.Interval = "1h"
+	}
+	if _, err := time.ParseDuration(c.MinAge); c.MinAge == "" || err != nil {
+		c.MinAge = "1h"
+	}
+	// Sidecar, journal and promote tmp files are not tracked as in flight;
+	// only their age tells them apart from leftovers.
+	if d, _ := time.ParseDuration(c.MinAge); d < minSweepAge {
+		c.MinAge = minSweepAge.String()
+	}
+	if c.Action != "report" {
+		c.Action = "quarantine"
+	}
+}
+
+// minSweepAge is the lowest accepted reconcile.minAge.
+const minSweepAge = 5 * time.Minute
+
+func (c *ReconcileConfig) interval() time.Duration {
+	d, _ := time.ParseDuration(c.Interval)
+	return d
+}
+
+func (c *ReconcileConfig) minAge() time.Duration {
+	d, _ := time.ParseDuration(c.MinAge)
+	return d
+}
+
+// SigningConfig signs the manifest sidecar of every archive with ed25519.
+type SigningConfig struct {
+	KeyFile       string `yaml:"keyFile"`       // PEM PKCS #8 private key; unset disables signing
+	PublicKeyFile string `yaml:"publicKeyFile"` // used by verify; derived from KeyFile when unset
+}
+
+// VerifyKeyFile returns the file verify reads the public key from.
+func (c SigningConfig) VerifyKeyFile() string {
+	if c.PublicKeyFile != "" {
+		return c.PublicKeyFile
+	}
+	return c.KeyFile
+}
+
+// PinConfig freezes the source files before they are read. Redis replaces
+// dump.rdb by rename, so a hardlink keeps the detected snapshot intact while
+// the next BGSAVE lands.
+type PinConfig struct {
+	Mode string `yaml:"mode"` // "auto" (hardlink, reflink, copy) | "copy" (reflink, copy) | "off"
+	Dir  string `yaml:"dir"`  // parent of the .rdb-archiver-pin folder, on the source filesystem (default: <source>)
+}
+
+type TargetConfig struct {
+	Name           string            `yaml:"name"`
+	Backend        string            `yaml:"backend"` // "local" | "s3"
+	S3             fs.S3Config       `yaml:"s3"`
+	Root           string            `yaml:"root"`
+	SubDir         string            `yaml:"subDir"`
+	SnapshotSubdir string            `yaml:"snapshotSubdir"`
+	Retention      RetentionConfig   `yaml:"retention"`
+	Compression    CompressionConfig `yaml:"compression"`
+	Encryption     crypt.Config      `yaml:"encryption"`
+	FailurePolicy  string            `yaml:"failurePolicy"` // "continue" | "fail"
+	ClusterSets    clusterset.Config `yaml:"clusterSets"`
+	// MaxMB caps the archives of all rule folders of the host folder, and
+	// MinFreeMB is the free space a local target keeps after writing. Archives
+	// are evicted to respect them, else the snapshot is refused. 0 disables.
+	MaxMB     int `yaml:"maxMB"`
+	MinFreeMB int `yaml:"minFreeMB"`
 }
 
 type RetentionConfig struct {
-	LastCount            int              `yaml:"lastCount"`
+	// Mode "folders" promotes snapshots into a folder per cron rule. Mode
+	// "calendar" keeps them all in the snapshot folder and prunes it by
+	// KeepLast and the calendar buckets; rule folders are then neither
+	// promoted into nor pruned.
+	Mode      string `yaml:"mode"` // folders | calendar
+	LastCount int    `yaml:"lastCount"`
+	// Calendar mode settings, as the fields of the same name of a rule;
+	// KeepLast is the rule Count.
+	KeepLast    int    `yaml:"keepLast"`
+	KeepHourly  int    `yaml:"keepHourly"`
+	KeepDaily   int    `yaml:"keepDaily"`
+	KeepWeekly  int    `yaml:"keepWeekly"`
+	KeepMonthly int    `yaml:"keepMonthly"`
+	KeepYearly  int    `yaml:"keepYearly"`
+	Timezone    string `yaml:"timezone"` // of the calendar buckets (default UTC)
+	// MinAge, MaxAge and KeepWithin apply to the snapshot folder like the
+	// fields of the same name of a rule.
+	MinAge               string           `yaml:"minAge"`
+	MaxAge               string           `yaml:"maxAge"`
+	KeepWithin           string           `yaml:"keepWithin"`
+	MaxMB                int              `yaml:"maxMB"`
 	RemoveUnknownFolders bool             `yaml:"removeUnknownFolders"`
 	Rules                []retention.Rule `yaml:"rules"`
+	// EvictionOrder lists the folders archives are evicted from first when
+	// maxMB or minFreeMB of the target is hit; the snapshot folder and the
+	// rules follow in their configured order.
+	EvictionOrder []string `yaml:"evictionOrder"`
+}
+
+// CompressionConfig overrides fs.Config compression settings for one target.
+type CompressionConfig struct {
+	Codec string `yaml:"codec"` // zstd | gzip | lz4 | xz | none
+	Level int    `yaml:"level"` // 0 uses fs.compressionLevel
 }
 
 func (c *Config) ApplyDefaults() {
+	if c.Validation == "" {
+		c.Validation = "reject"
+	}
+	if c.TimestampSource == "" {
+		c.TimestampSource = "mtime"
+	}
+	if c.Pin.Mode == "" {
+		c.Pin.Mode = "auto"
+	}
+	if c.Preempt != "cancel" {
+		c.Preempt = "finish"
+	}
+	c.Reconcile.ApplyDefaults()
+	c.TargetConfig.ApplyDefaults()
+	for i := range c.Targets {
+		if c.Targets[i].Name == "" {
+			c.Targets[i].Name = fmt.Sprintf("target-%d", i)
+		}
+		c.Targets[i].ApplyDefaults()
+	}
+}
+
+// TargetConfigs returns the effective list of destinations.
+func (c *Config) TargetConfigs() []TargetConfig {
+	if len(c.Targets) > 0 {
+		return c.Targets
+	}
+	return []TargetConfig{c.TargetConfig}
+}
+
+// KeyFiles lists the encryption and signing key files.
+func (c *Config) KeyFiles() []string {
+	var files []string
+	if c.Signing.KeyFile != "" {
+		files = append(files, c.Signing.KeyFile)
+	}
+	for _, t := range c.TargetConfigs() {
+		for _, f := range t.Encryption.Files() {
+			if !slices.Contains(files, f) {
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+func (c *TargetConfig) ApplyDefaults() {
+	if c.Name == "" {
+		c.Name = "default"
+	}
+	if c.Backend == "" {
+		c.Backend = "local"
+	}
+	if c.Backend == "s3" {
+		c.S3.ApplyDefaults()
+	}
 	if c.Root == "" {
 		c.Root = "/var/backups/redis"
 	}
@@ -25,6 +215,17 @@ func (c *Config) ApplyDefaults() {
 	if c.SnapshotSubdir == "" {
 		c.SnapshotSubdir = "snapshots"
 	}
+	if c.FailurePolicy == "" {
+		c.FailurePolicy = "continue"
+	}
+	if c.Compression.Codec == "" {
+		c.Compression.Codec = fs.DefaultCodec
+	}
+	c.Encryption.ApplyDefaults()
+	if c.ClusterSets.Rule == "" {
+		c.ClusterSets.Rule = c.SnapshotSubdir
+	}
+	c.ClusterSets.ApplyDefaults()
 	c.Retention.ApplyDefaults()
 }
 
@@ -32,5 +233,11 @@ func (c *RetentionConfig) ApplyDefaults() {
 	if c.LastCount == 0 {
 		c.LastCount = 5 // keep last 5 snapshots
 	}
+	if c.Mode != "calendar" {
+		c.Mode = "folders"
+	}
+	if c.Mode == "calendar" && c.KeepLast+c.KeepHourly+c.KeepDaily+c.KeepWeekly+c.KeepMonthly+c.KeepYearly == 0 {
+		c.KeepLast = c.LastCount // an empty policy would remove every snapshot
+	}
 	// Rules slice can stay empty; no default needed.
 }
@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/journal"
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+// reconcile finishes what a previous run left in the target journals: partial
+// archives of an interrupted snapshot are removed, and committed archives get
+// their retention applied. An interrupted snapshot is archived again when the
+// watcher detects it on startup; targets that committed it are then skipped.
+func (w *Worker) reconcile(ctx context.Context) {
+	w.mu.RLock()
+	targets := append([]*target(nil), w.targets...)
+	w.mu.RUnlock()
+
+	for _, t := range targets {
+		logg := w.logg.With("target", t.cfg.Name)
+		rec, err := t.journal.Last(ctx)
+		if err != nil {
+			logg.Warn("reading journal failed", "path", t.journal.Path(), "error", err)
+			continue
+		}
+		if rec == nil {
+			continue
+		}
+
+		switch rec.State {
+		case journal.Detected, journal.InProgress:
+			removePartial(ctx, logg, t.fs, rec.Partial)
+			removePartial(ctx, logg, w.local, rec.Staging)
+			logg.Warn("snapshot archiving was interrupted", "snapshot", rec.Snapshot, "source", rec.Source, "state", rec.State)
+			w.advance(ctx, t, journal.Failed, "")
+
+		case journal.Committed:
+			if _, err := t.fs.Stat(ctx, rec.Archive); err != nil {
+				logg.Warn("committed archive is missing", "archive", rec.Archive, "error", err)
+				w.advance(ctx, t, journal.Failed, "")
+				continue
+			}
+			at, err := snapshot.ParseTimestamp(rec.Snapshot)
+			if err != nil {
+				at = time.Now()
+			}
+			protected, ok := w.updateClusterSets(ctx, t, at, false)
+			if !ok {
+				logg.Warn("cluster sets unknown, skipping retention to keep them intact")
+				continue
+			}
+			logg.Info("applying retention left by an interrupted run", "archive", rec.Archive)
+			if err := t.retention.Apply(ctx, t.fs, t.root(), rec.Archive, protected); err != nil {
+				logg.Error("worker: retention failed", "error", err)
+				continue
+			}
+			w.advance(ctx, t, journal.Promoted, "")
+		}
+	}
+}
+
+// removePartial removes the listed leftovers of an interrupted archive.
+func removePartial(ctx context.Context, logg logging.Logger, filesystem fs.FS, paths []string) {
+	for _, p := range paths {
+		if _, err := filesystem.Stat(ctx, p); err != nil {
+			continue
+		}
+		if err := filesystem.RemoveAll(ctx, p); err != nil {
+			continue
+		}
+		logg.Info("removed partial archive", "path", p)
+	}
+}
+
+// pending journals snap as detected for every target and returns the targets
+// still to archive it; those that already committed it are skipped.
+func (w *Worker) pending(ctx context.Context, targets []*target, ts string, primary snapshot.Artifact) []*target {
+	out := make([]*target, 0, len(targets))
+	for _, t := range targets {
+		rec, err := t.journal.Last(ctx)
+		if err != nil {
+			w.logg.Warn("reading journal failed", "target", t.cfg.Name, "path", t.journal.Path(), "error", err)
+		}
+		if rec.Same(ts, primary) && rec.Done() {
+			if _, err := t.fs.Stat(ctx, rec.Archive); err == nil {
+				w.logg.Info("snapshot already archived, skipping target", "target", t.cfg.Name, "archive", rec.Archive)
+				continue
+			}
+		}
+		if err := t.journal.Write(ctx, journal.NewRecord(ts, primary)); err != nil {
+			w.logg.Warn("updating journal failed", "target", t.cfg.Name, "error", err)
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// begin journals the files about to be written for t.
+func (w *Worker) begin(ctx context.Context, t *target, partial, staging []string) {
+	rec, _ := t.journal.Last(ctx)
+	if rec == nil {
+		return
+	}
+	next := *rec
+	next.State, next.Partial, next.Staging = journal.InProgress, partial, staging
+	if err := t.journal.Write(ctx, next); err != nil {
+		w.logg.Warn("updating journal failed", "target", t.cfg.Name, "error", err)
+	}
+}
+
+// advance moves the journal of t to state. Journal failures never fail the
+// archive; they only weaken the recovery after a crash.
+func (w *Worker) advance(ctx context.Context, t *target, state journal.State, archive string) {
+	if err := t.journal.Advance(ctx, state, archive); err != nil {
+		w.logg.Warn("updating journal failed", "target", t.cfg.Name, "state", state, "error", err)
+	}
+}
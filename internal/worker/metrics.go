@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/metrics"
+)
+
+var snapshotsRejected = metrics.NewCounter(
+	"rdb_archiver_snapshots_rejected_total",
+	"Snapshots that failed RDB validation, by action taken (reject, quarantine).",
+	"action",
+)
+
+var snapshotsArchived = metrics.NewCounter(
+	"rdb_archiver_snapshots_archived_total",
+	"Snapshots archived, by target.",
+	"target",
+)
+
+var snapshotsFailed = metrics.NewCounter(
+	"rdb_archiver_snapshots_failed_total",
+	"Snapshots that could not be archived or were quarantined, by target.",
+	"target",
+)
+
+var snapshotsPreempted = metrics.NewCounter(
+	"rdb_archiver_snapshots_preempted_total",
+	"Snapshots whose archiving was cancelled because a newer one arrived.",
+)
+
+var archiveDuration = metrics.NewHistogram(
+	"rdb_archiver_archive_duration_seconds",
+	"Time to write or copy an archive into a target.",
+	metrics.ExponentialBuckets(0.1, 2, 14), // 100ms .. ~14m
+	"target",
+)
+
+var archiveSize = metrics.NewHistogram(
+	"rdb_archiver_archive_size_bytes",
+	"Size of the archives written, by target.",
+	metrics.ExponentialBuckets(1<<20, 4, 10), // 1MiB .. 256GiB
+	"target",
+)
+
+var compressionRatio = metrics.NewGauge(
+	"rdb_archiver_compression_ratio",
+	"Uncompressed size of the snapshot divided by the size of its latest archive, by target.",
+	"target",
+)
+
+var lastSuccess = metrics.NewGauge(
+	"rdb_archiver_last_success_timestamp_seconds",
+	"Unix time of the latest successful archive, by target.",
+	"target",
+)
+
+var spaceRefusals = metrics.NewCounter(
+	"rdb_archiver_space_refusals_total",
+	"Snapshots refused by a target because maxMB or minFreeMB could not be met, by target.",
+	"target",
+)
+
+var freeSpaceErrors = metrics.NewCounter(
+	"rdb_archiver_free_space_errors_total",
+	"Failures to read the free space of a target with minFreeMB, which refuse the snapshot, by target.",
+	"target",
+)
+
+var tmpRemoved = metrics.NewCounter(
+	"rdb_archiver_tmp_files_removed_total",
+	"Stale tmp files of interrupted writes removed by the reconcile sweep, by target.",
+	"target",
+)
+
+var brokenArchives = metrics.NewCounter(
+	"rdb_archiver_broken_archives_total",
+	"Empty, unreadable or truncated archives found by the reconcile sweep, by target and reason.",
+	"target", "reason",
+)
+
+var clusterSetsAssembled = metrics.NewCounter(
+	"rdb_archiver_cluster_sets_total",
+	"Cluster snapshot sets assembled, by completeness.",
+	"complete",
+)
+
+// observeArchive records a successful archive of target.
+func observeArchive(target string, res archiveResult) {
+	snapshotsArchived.Inc(target)
+	archiveDuration.Observe(res.took.Seconds(), target)
+	archiveSize.Observe(float64(res.sums.Archive.Size), target)
+	var raw int64
+	for _, m := range res.sums.Members {
+		raw += m.Size
+	}
+	if res.sums.Archive.Size > 0 {
+		compressionRatio.Set(float64(raw)/float64(res.sums.Archive.Size), target)
+	}
+	lastSuccess.Set(float64(time.Now().Unix()), target)
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+// pinSubdir is the folder the worker owns inside the pin dir, by default the
+// source dir, which guarantees the same filesystem for hardlinks and reflinks.
+// Only this folder is ever cleared: the pin dir itself may hold other files.
+const pinSubdir = ".rdb-archiver-pin"
+
+// pin freezes the snapshot files into the pin dir and returns the snapshot
+// reading from there. release removes the pinned files and must be called on
+// every path; leftovers of a crash are removed by the next pin. Without a
+// configured pin dir, a source dir the worker cannot write to, such as a
+// read-only mount, is read from directly as with mode "off".
+func (w *Worker) pin(ctx context.Context, snap snapshot.Snapshot, cfg PinConfig) (pinned snapshot.Snapshot, release func(), err error) {
+	if cfg.Mode == "off" {
+		return snap, func() {}, nil
+	}
+
+	parent := cfg.Dir
+	if parent == "" {
+		parent = snap.Dir
+	}
+	dir := filepath.Join(parent, pinSubdir)
+	// The worker handles one snapshot at a time: anything still here is stale.
+	if err := w.local.RemoveAll(ctx, dir); err != nil {
+		return snap, nil, fmt.Errorf("clearing pin dir: %w", err)
+	}
+	if err := w.local.MkdirAll(dir); err != nil {
+		if cfg.Dir == "" {
+			w.logg.Warn("source dir not writable, archiving the snapshot unpinned; set pin.dir to pin it elsewhere", "dir", dir, "error", err)
+			return snap, func() {}, nil
+		}
+		return snap, nil, fmt.Errorf("creating pin dir: %w", err)
+	}
+	release = func() {
+		if err := w.local.RemoveAll(context.WithoutCancel(ctx), dir); err != nil {
+			w.logg.Warn("removing pinned files failed", "dir", dir, "error", err)
+		}
+	}
+
+	pinned = snap
+	pinned.Dir = dir
+	pinned.Aux = make([]snapshot.Artifact, len(snap.Aux))
+
+	pinOne := func(a snapshot.Artifact) (snapshot.Artifact, error) {
+		src := filepath.Join(snap.Dir, a.Name)
+		dst := filepath.Join(dir, a.Name)
+		if err := w.local.MkdirAll(filepath.Dir(dst)); err != nil {
+			return a, err
+		}
+		method, err := w.local.Pin(src, dst, cfg.Mode == "auto")
+		if err != nil {
+			return a, err
+		}
+
+		// The source may have been replaced since detection; archive what was pinned.
+		st, err := os.Stat(dst)
+		if err != nil {
+			return a, err
+		}
+		if !a.Growing && (st.Size() != a.Size || !st.ModTime().Equal(a.ModTime)) {
+			w.logg.Debug("source replaced since detection, archiving the newer file", "file", a.Name)
+			a.Size, a.ModTime = st.Size(), st.ModTime()
+		}
+		w.logg.Debug("source pinned", "file", a.Name, "method", method)
+		return a, nil
+	}
+
+	if pinned.Primary, err = pinOne(snap.Primary); err != nil {
+		release()
+		return snap, nil, fmt.Errorf("pinning %s: %w", snap.Primary.Name, err)
+	}
+	for i, a := range snap.Aux {
+		if pinned.Aux[i], err = pinOne(a); err != nil {
+			release()
+			return snap, nil, fmt.Errorf("pinning %s: %w", a.Name, err)
+		}
+	}
+	return pinned, release, nil
+}
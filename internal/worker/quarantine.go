@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+)
+
+// Quarantine moves a stored archive with its sidecar and signature into
+// <root>/quarantine/<rule>/, where retention neither counts nor removes it.
+// It returns the new archive path. Sidecars that cannot be moved are logged.
+func Quarantine(ctx context.Context, logg logging.Logger, filesystem fs.FS, root, rule, archive string) (string, error) {
+	dir := filepath.Join(root, QuarantineSubdir, rule)
+	if err := filesystem.MkdirAll(dir); err != nil {
+		return "", fmt.Errorf("creating quarantine folder: %w", err)
+	}
+
+	target := filepath.Join(dir, filepath.Base(archive))
+	if err := filesystem.Rename(ctx, archive, target); err != nil {
+		return "", err
+	}
+	for _, pathFn := range []func(string) string{manifest.SidecarPath, manifest.SignaturePath} {
+		src := pathFn(archive)
+		if _, err := filesystem.Stat(ctx, src); err != nil {
+			continue
+		}
+		if err := filesystem.Rename(ctx, src, pathFn(target)); err != nil {
+			logg.Warn("quarantining manifest sidecar failed", "path", src, "error", err)
+		}
+	}
+	return target, nil
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/snapshot"
+)
+
+// errNoSpace refuses a snapshot that does not fit the size limits of a target.
+var errNoSpace = errors.New("not enough space for the archive")
+
+// admit splits group into the targets with room for the snapshot and those
+// refused, evicting archives where maxMB or minFreeMB requires it.
+func (w *Worker) admit(ctx context.Context, group []*target, snap snapshot.Snapshot) (admitted []*target, refused map[*target]error) {
+	var raw int64
+	for _, a := range append([]snapshot.Artifact{snap.Primary}, snap.Aux...) {
+		raw += a.Size
+	}
+
+	refused = make(map[*target]error)
+	for _, t := range group {
+		w.mu.RLock()
+		need := t.progress.lastSize
+		w.mu.RUnlock()
+		if need == 0 {
+			need = raw // nothing archived yet: assume no compression
+		}
+		need += need / 10 // snapshots grow
+
+		if err := w.ensureSpace(ctx, t, need); err != nil {
+			spaceRefusals.Inc(t.cfg.Name)
+			refused[t] = err
+			continue
+		}
+		admitted = append(admitted, t)
+	}
+	return admitted, refused
+}
+
+// ensureSpace makes room for need more bytes in t: the archives of its rule
+// folders must stay within maxMB and, on local targets, minFreeMB must remain
+// free. Archives are evicted in the retention eviction order until both hold.
+// A target whose free space cannot be read is refused without evicting.
+func (w *Worker) ensureSpace(ctx context.Context, t *target, need int64) error {
+	maxBytes := int64(t.cfg.MaxMB) << 20
+	minFree := int64(t.cfg.MinFreeMB) << 20
+	sr, statfs := t.fs.(fs.SpaceReporter)
+	if minFree <= 0 || !statfs {
+		minFree = 0
+	}
+	if maxBytes <= 0 && minFree <= 0 {
+		return nil
+	}
+
+	var (
+		reason  string
+		statErr error
+	)
+	fits := func(used int64) bool {
+		if maxBytes > 0 && used+need > maxBytes {
+			reason = fmt.Sprintf("%d MB stored and about %d MB needed exceed maxMB %d", used>>20, need>>20, t.cfg.MaxMB)
+			return false
+		}
+		if minFree > 0 {
+			free, err := sr.FreeSpace(t.root())
+			if err != nil {
+				statErr = err
+				return true // stops the eviction; refused below
+			}
+			if free-need < minFree {
+				reason = fmt.Sprintf("%d MB free and about %d MB needed leave less than minFreeMB %d", free>>20, need>>20, t.cfg.MinFreeMB)
+				return false
+			}
+		}
+		return true
+	}
+
+	protected, ok := w.updateClusterSets(ctx, t, time.Time{}, false)
+	if !ok {
+		// Evicting could break a cluster set: only check.
+		if fits(t.retention.Usage(ctx, t.fs, t.root())) {
+			return w.statFailed(t, statErr)
+		}
+		return fmt.Errorf("%w: %s (cluster sets unknown, nothing evicted)", errNoSpace, reason)
+	}
+	if !t.retention.Evict(ctx, t.fs, t.root(), protected, fits) {
+		return fmt.Errorf("%w: %s", errNoSpace, reason)
+	}
+	return w.statFailed(t, statErr)
+}
+
+// statFailed refuses a snapshot whose target's free space could not be read:
+// that is when writing a large archive is riskiest.
+func (w *Worker) statFailed(t *target, err error) error {
+	if err == nil {
+		return nil
+	}
+	freeSpaceErrors.Inc(t.cfg.Name)
+	w.logg.Warn("reading free space failed", "target", t.cfg.Name, "error", err)
+	return fmt.Errorf("%w: reading free space: %v", errNoSpace, err)
+}
@@ -0,0 +1,262 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/catalog"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/journal"
+)
+
+// maxBroken bounds the broken archives kept in ReconcileStatus.
+const maxBroken = 50
+
+// ReconcileStatus reports the latest sweep of the archive tree.
+type ReconcileStatus struct {
+	LastRun    time.Time       `json:"lastRun"`
+	NextRun    time.Time       `json:"nextRun"`
+	TmpRemoved int             `json:"tmpRemoved"` // by the latest sweep
+	Broken     []BrokenArchive `json:"broken,omitempty"`
+}
+
+// BrokenArchive is an empty, unreadable or truncated archive found by a sweep.
+type BrokenArchive struct {
+	Target      string `json:"target"`
+	Archive     string `json:"archive"`
+	Reason      string `json:"reason"`                // empty | unreadable | truncated | size mismatch
+	Quarantined string `json:"quarantined,omitempty"` // new location
+}
+
+// Reconciled returns the outcome of the latest sweep.
+func (w *Worker) Reconciled() ReconcileStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	st := w.swept
+	st.Broken = append([]BrokenArchive(nil), w.swept.Broken...)
+	return st
+}
+
+// sweepLoop sweeps on startup, then every Reconcile.Interval until ctx is done.
+func (w *Worker) sweepLoop(ctx context.Context) {
+	w.sweep(ctx)
+	for {
+		w.mu.Lock()
+		d := w.cfg.Reconcile.interval()
+		next := w.swept.LastRun.Add(d)
+		if d <= 0 {
+			next = time.Time{}
+		}
+		w.swept.NextRun = next
+		w.mu.Unlock()
+
+		// A nil channel blocks: without interval only a reload wakes the loop.
+		var (
+			t     *time.Timer
+			timer <-chan time.Time
+		)
+		if d > 0 {
+			t = time.NewTimer(time.Until(next))
+			timer = t.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if t != nil {
+				t.Stop()
+			}
+			return
+		case <-w.reload:
+			if t != nil {
+				t.Stop()
+			}
+		case <-timer:
+			w.sweep(ctx)
+		}
+	}
+}
+
+// sweep removes stale tmp files from every target and reports empty,
+// unreadable or truncated archives, quarantining them unless the action is "report".
+// Files journaled as being written are never touched.
+func (w *Worker) sweep(ctx context.Context) {
+	w.mu.RLock()
+	targets := append([]*target(nil), w.targets...)
+	cfg := w.cfg.Reconcile
+	w.mu.RUnlock()
+
+	busy := make(map[string]bool)
+	for _, t := range targets {
+		if rec, err := t.journal.Last(ctx); err == nil && rec != nil && rec.State == journal.InProgress {
+			for _, p := range rec.Partial {
+				busy[p] = true
+			}
+		}
+	}
+
+	st := ReconcileStatus{LastRun: time.Now()}
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			return
+		}
+		w.sweepTarget(ctx, t, cfg, busy, &st)
+	}
+
+	w.mu.Lock()
+	st.NextRun = w.swept.NextRun
+	w.swept = st
+	w.mu.Unlock()
+	if st.TmpRemoved > 0 || len(st.Broken) > 0 {
+		w.logg.Info("archive tree swept", "tmpRemoved", st.TmpRemoved, "broken", len(st.Broken))
+	}
+}
+
+func (w *Worker) sweepTarget(ctx context.Context, t *target, cfg ReconcileConfig, busy map[string]bool, st *ReconcileStatus) {
+	logg := w.logg.With("target", t.cfg.Name)
+	root := t.root()
+
+	entries, err := t.fs.ReadDir(ctx, root)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		logg.Warn("reading archive root failed", "root", root, "error", err)
+		return
+	}
+
+	// The root itself only holds the journal and its leftovers; quarantine
+	// folders are swept for tmp files only.
+	type folder struct {
+		dir, rule string
+		check     bool
+	}
+	folders := []folder{{dir: root}}
+	for _, ent := range entries {
+		if !ent.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, ent.Name())
+		if ent.Name() != QuarantineSubdir {
+			folders = append(folders, folder{dir: dir, rule: ent.Name(), check: true})
+			continue
+		}
+		folders = append(folders, folder{dir: dir})
+		sub, err := t.fs.ReadDir(ctx, dir)
+		if err != nil {
+			logg.Warn("reading quarantine folder failed", "dir", dir, "error", err)
+			continue
+		}
+		for _, s := range sub {
+			if s.IsDir() {
+				folders = append(folders, folder{dir: filepath.Join(dir, s.Name())})
+			}
+		}
+	}
+
+	minAge := cfg.minAge()
+	for _, f := range folders {
+		files, err := t.fs.ReadDir(ctx, f.dir)
+		if err != nil {
+			logg.Warn("reading folder failed", "dir", f.dir, "error", err)
+			continue
+		}
+		for _, ent := range files {
+			if ent.IsDir() {
+				continue
+			}
+			info, err := ent.Info()
+			if err != nil || time.Since(info.ModTime()) < minAge {
+				continue
+			}
+			path := filepath.Join(f.dir, ent.Name())
+
+			switch {
+			case strings.HasPrefix(ent.Name(), ".tmp-"):
+				if busy[path] {
+					continue
+				}
+				if err := t.fs.RemoveAll(ctx, path); err != nil {
+					logg.Warn("removing stale tmp file failed", "path", path, "error", err)
+					continue
+				}
+				tmpRemoved.Inc(t.cfg.Name)
+				st.TmpRemoved++
+				logg.Info("stale tmp file removed", "path", path, "modTime", info.ModTime())
+
+			case f.check && !strings.HasPrefix(ent.Name(), ".") && fs.IsArchive(ent.Name()):
+				reason := checkReadable(ctx, t.fs, path, info.Size())
+				if reason == "" {
+					continue
+				}
+				brokenArchives.Inc(t.cfg.Name, reason)
+				logg.Error("broken archive found", "archive", path, "reason", reason)
+				b := BrokenArchive{Target: t.cfg.Name, Archive: path, Reason: reason}
+				if cfg.Action == "quarantine" {
+					q, err := Quarantine(ctx, logg, t.fs, root, f.rule, path)
+					if err != nil {
+						logg.Error("quarantining archive failed", "archive", path, "error", err)
+					} else {
+						logg.Warn("archive quarantined", "archive", path, "quarantine", q)
+						b.Quarantined = q
+					}
+				}
+				if len(st.Broken) < maxBroken {
+					st.Broken = append(st.Broken, b)
+				}
+			}
+		}
+	}
+}
+
+// checkReadable returns why the archive at path cannot be restored from, or
+// "" when its first bytes can be read and it looks complete: its size matches
+// the manifest sidecar or, without one, its last bytes end the way its format
+// does. The tail is only read where the destination can seek, and is not
+// checked for formats without a fixed trailer.
+func checkReadable(ctx context.Context, filesystem fs.FS, path string, size int64) string {
+	if size == 0 {
+		return "empty"
+	}
+	in, err := filesystem.Open(ctx, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "" // removed by retention since listed
+	}
+	if err != nil {
+		return "unreadable"
+	}
+	defer in.Close()
+	if _, err := io.ReadFull(in, make([]byte, min(size, 512))); err != nil {
+		return "unreadable"
+	}
+
+	if m, err := catalog.ReadSidecar(ctx, filesystem, path); err == nil && m.Checksums != nil {
+		switch want := m.Checksums.Archive.Size; {
+		case size < want:
+			return "truncated"
+		case size > want:
+			return "size mismatch"
+		}
+		return ""
+	}
+
+	seeker, ok := in.(io.Seeker)
+	if !ok {
+		return ""
+	}
+	tail := make([]byte, min(size, fs.TailSize))
+	if _, err := seeker.Seek(-int64(len(tail)), io.SeekEnd); err != nil {
+		return "unreadable"
+	}
+	if _, err := io.ReadFull(in, tail); err != nil {
+		return "unreadable"
+	}
+	if complete, known := fs.CheckTail(path, tail); known && !complete {
+		return "truncated"
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package worker
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/raoulx24/rdb-archiver/internal/crypt"
+	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/journal"
+	"github.com/raoulx24/rdb-archiver/internal/logging"
+	"github.com/raoulx24/rdb-archiver/internal/retention"
+)
+
+// target is one destination the worker fans snapshots out to.
+// Each target owns its backend and retention engine. A target is never
+// modified once published in Worker.targets: a reload replaces it, so an
+// archive in flight keeps a consistent view. Only progress changes.
+type target struct {
+	cfg       TargetConfig
+	fs        fs.FS
+	sealer    *crypt.Sealer // nil when archives are stored unencrypted
+	retention *retention.Retention
+	journal   *journal.Journal // progress of the latest snapshot, for crash recovery
+	progress  *progress        // shared with the targets replacing this one
+}
+
+// progress is the mutable state of a target, guarded by Worker.mu.
+type progress struct {
+	status   TargetStatus
+	lastSize int64 // of the latest archive, to estimate the next one
+}
+
+// TargetStatus reports the outcome of the latest archive attempts for one target.
+type TargetStatus struct {
+	Name                string    `json:"name"`
+	Backend             string    `json:"backend"`
+	LastAttempt         time.Time `json:"lastAttempt"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	LastArchive         string    `json:"lastArchive,omitempty"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+func newTarget(cfg TargetConfig, local *fs.OSFS, log logging.Logger) (*target, error) {
+	if _, err := fs.CodecByName(cfg.Compression.Codec); err != nil {
+		return nil, err
+	}
+	sealer, err := crypt.NewSealer(cfg.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+	dst, err := fs.Open(cfg.Backend, cfg.S3, local)
+	if err != nil {
+		return nil, err
+	}
+	t := &target{
+		cfg:       cfg,
+		fs:        dst,
+		sealer:    sealer,
+		retention: retention.New(log.With("target", cfg.Name)),
+		progress:  &progress{status: TargetStatus{Name: cfg.Name, Backend: cfg.Backend}},
+	}
+	t.journal = journal.New(dst, t.root())
+	t.updateRetentionRules()
+	return t, nil
+}
+
+// reloaded returns a target with cfg and sealer replacing t. It keeps the
+// backend, retention engine and progress of t, and its journal unless the
+// root moved.
+func (t *target) reloaded(cfg TargetConfig, sealer *crypt.Sealer) *target {
+	n := &target{
+		cfg:       cfg,
+		fs:        t.fs,
+		sealer:    sealer,
+		retention: t.retention,
+		journal:   t.journal,
+		progress:  t.progress,
+	}
+	if n.root() != t.root() {
+		n.journal = journal.New(n.fs, n.root())
+	}
+	n.updateRetentionRules()
+	return n
+}
+
+// root is the per-host folder holding the snapshot and rule folders.
+func (t *target) root() string {
+	return filepath.Join(t.cfg.Root, t.cfg.SubDir)
+}
+
+func (t *target) snapshotDir() string {
+	return filepath.Join(t.root(), t.cfg.SnapshotSubdir)
+}
+
+// archiveDir is where a snapshot lands: the snapshot folder, or the quarantine
+// folder for snapshots that failed validation.
+func (t *target) archiveDir(quarantine bool) string {
+	if quarantine {
+		return filepath.Join(t.root(), QuarantineSubdir)
+	}
+	return t.snapshotDir()
+}
+
+// archiveName is the file name of the archive for timestamp ts.
+func (t *target) archiveName(ts string, codec fs.Codec) string {
+	name := ts + codec.Ext()
+	if t.sealer != nil {
+		name += fs.SealedExt
+	}
+	return name
+}
+
+func (t *target) isLocal() bool {
+	return t.cfg.Backend == "local"
+}
+
+// updateRetentionRules adds to the retention rules the snapshotwatcher one
+func (t *target) updateRetentionRules() {
+	cfg := t.cfg.Retention
+	mainRule := retention.Rule{
+		Name:       t.cfg.SnapshotSubdir,
+		Cron:       "",
+		Count:      cfg.LastCount,
+		MinAge:     cfg.MinAge,
+		MaxAge:     cfg.MaxAge,
+		KeepWithin: cfg.KeepWithin,
+		MaxMB:      cfg.MaxMB,
+	}
+	updated := append([]retention.Rule{mainRule}, cfg.Rules...)
+	reserved := []string{QuarantineSubdir}
+	if cfg.Mode == "calendar" {
+		mainRule.Count = cfg.KeepLast
+		mainRule.KeepHourly = cfg.KeepHourly
+		mainRule.KeepDaily = cfg.KeepDaily
+		mainRule.KeepWeekly = cfg.KeepWeekly
+		mainRule.KeepMonthly = cfg.KeepMonthly
+		mainRule.KeepYearly = cfg.KeepYearly
+		mainRule.Timezone = cfg.Timezone
+		// Rule folders are left untouched: switching to calendar mode must
+		// not lose the archives promoted so far.
+		updated = []retention.Rule{mainRule}
+		for _, r := range cfg.Rules {
+			reserved = append(reserved, r.Name)
+		}
+	}
+	t.retention.UpdateConfig(retention.Config{
+		Target:               t.cfg.Name,
+		RemoveUnknownFolders: cfg.RemoveUnknownFolders,
+		Rules:                updated,
+		Reserved:             reserved,
+		EvictionOrder:        cfg.EvictionOrder,
+	})
+}
+
+func (t *target) recordSuccess(archive string) {
+	now := time.Now()
+	st := &t.progress.status
+	st.LastAttempt = now
+	st.LastSuccess = now
+	st.LastArchive = archive
+	st.LastError = ""
+	st.ConsecutiveFailures = 0
+}
+
+func (t *target) recordFailure(err error) {
+	st := &t.progress.status
+	st.LastAttempt = time.Now()
+	st.LastError = err.Error()
+	st.ConsecutiveFailures++
+}
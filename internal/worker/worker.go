@@ -3,108 +3,623 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/raoulx24/rdb-archiver/internal/catalog"
+	"github.com/raoulx24/rdb-archiver/internal/cluster"
+	"github.com/raoulx24/rdb-archiver/internal/crypt"
 	"github.com/raoulx24/rdb-archiver/internal/fs"
+	"github.com/raoulx24/rdb-archiver/internal/journal"
 	"github.com/raoulx24/rdb-archiver/internal/logging"
 	"github.com/raoulx24/rdb-archiver/internal/mailbox"
-	"github.com/raoulx24/rdb-archiver/internal/retention"
+	"github.com/raoulx24/rdb-archiver/internal/manifest"
+	"github.com/raoulx24/rdb-archiver/internal/rdb"
 	"github.com/raoulx24/rdb-archiver/internal/snapshot"
 )
 
+// errPreempted cancels a Handle call when a newer snapshot arrives.
+var errPreempted = errors.New("superseded by a newer snapshot")
+
 // Worker writes snapshots into destination folders and applies retention.
 type Worker struct {
 	mu        sync.RWMutex
 	cfg       Config
-	fs        fs.FS
+	targets   []*target
+	local     *fs.OSFS
+	signer    *manifest.Signer // nil when sidecars are not signed
 	logg      logging.Logger
-	retention *retention.Retention
 	mb        *mailbox.Mailbox[snapshot.Job]
+	preempted uint64
+	swept     ReconcileStatus
+	reload    chan struct{} // wakes sweepLoop after a config change
+}
+
+// QueueStatus reports snapshots that were never archived.
+type QueueStatus struct {
+	Pending   bool   `json:"pending"`   // a snapshot waits for the worker
+	Dropped   uint64 `json:"dropped"`   // replaced by a newer one before being taken
+	Preempted uint64 `json:"preempted"` // cancelled mid-archive by a newer one
+	Preempt   string `json:"preempt"`   // policy: finish | cancel
 }
 
 // New creates a worker using destination config and mailbox.
-func New(cfg Config, log logging.Logger, r *retention.Retention, mb *mailbox.Mailbox[snapshot.Job], filesystem fs.FS) *Worker {
+// The local filesystem is used for source files and as the default destination backend.
+func New(cfg Config, log logging.Logger, mb *mailbox.Mailbox[snapshot.Job], local *fs.OSFS) (*Worker, error) {
 	logg := log.With("pkg", "worker")
 	logg.Debug("creating worker")
-	return &Worker{
-		cfg:       cfg,
-		fs:        filesystem,
-		logg:      logg,
-		retention: r,
-		mb:        mb,
+
+	w := &Worker{
+		cfg:    cfg,
+		local:  local,
+		logg:   logg,
+		mb:     mb,
+		reload: make(chan struct{}, 1),
+	}
+
+	if cfg.Signing.KeyFile != "" {
+		signer, err := manifest.LoadSigner(cfg.Signing.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("signing: %w", err)
+		}
+		w.signer = signer
+	}
+
+	for _, tc := range cfg.TargetConfigs() {
+		t, err := newTarget(tc, local, logg)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", tc.Name, err)
+		}
+		w.targets = append(w.targets, t)
 	}
-}
 
-// UpdateConfig hot‑reloads destination settings.
+	return w, nil
+}
 
 // Start runs the worker loop using mailbox semantics.
 func (w *Worker) Start(ctx context.Context) {
 	w.logg.Info("starting worker")
-	w.updateRetentionRules()
+	w.reconcile(ctx)
+	go w.sweepLoop(ctx)
+
+	var dropped uint64
 	for {
 		job, ok := w.mb.Take(ctx)
 		if !ok {
 			w.logg.Info("worker stopped")
 			return
 		}
-		if err := w.Handle(ctx, job.Snap); err != nil {
+		if n := w.mb.Dropped(); n > dropped {
+			w.logg.Warn("snapshots superseded before archiving", "count", n-dropped, "total", n)
+			dropped = n
+		}
+
+		err := w.handleJob(ctx, job)
+		switch {
+		case errors.Is(err, errPreempted):
+			w.mu.Lock()
+			w.preempted++
+			w.mu.Unlock()
+			snapshotsPreempted.Inc()
+			w.logg.Warn("snapshot archiving cancelled, a newer snapshot arrived", "file", job.Snap.Primary.Name, "modTime", job.Snap.Primary.ModTime)
+		case err != nil && ctx.Err() != nil:
+			w.logg.Info("snapshot archiving stopped by shutdown", "file", job.Snap.Primary.Name)
+		case err != nil:
 			w.logg.Error("snapshot handle failed", "error", err)
 		}
 	}
 }
 
-// Handle writes a snapshotwatcher directory and applies retention.
+// handleJob runs Handle; with the "cancel" preempt policy a job put into the
+// mailbox meanwhile cancels it.
+func (w *Worker) handleJob(ctx context.Context, job snapshot.Job) error {
+	w.mu.RLock()
+	preempt := w.cfg.Preempt
+	w.mu.RUnlock()
+	if preempt != "cancel" {
+		return w.Handle(ctx, job.Snap)
+	}
+
+	hctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		select {
+		case <-w.mb.Arrived():
+			cancel(errPreempted)
+		case <-hctx.Done():
+		}
+	}()
+	return w.Handle(hctx, job.Snap)
+}
+
+// Handle archives the snapshot into every target and applies their retention.
+// A failing target never prevents the others from being written; the returned
+// error only covers targets whose failure policy is "fail".
 func (w *Worker) Handle(ctx context.Context, snap snapshot.Snapshot) error {
 	w.logg.Debug("worker starting snapshot handling")
-	finalDir, err := w.writeSnapshot(ctx, snap)
+
+	w.mu.RLock()
+	targets := append([]*target(nil), w.targets...)
+	stagingDir := w.cfg.StagingDir
+	validation := w.cfg.Validation
+	tsSource := w.cfg.TimestampSource
+	pinCfg := w.cfg.Pin
+	signer := w.signer
+	w.mu.RUnlock()
+
+	snap, release, err := w.pin(ctx, snap, pinCfg)
 	if err != nil {
 		return err
 	}
+	defer release()
+
+	m := manifest.New()
+	m.Capture = snap.Capture
+	m.Mode, m.AOF = snap.Mode, snap.AOF
+	for _, a := range append([]snapshot.Artifact{snap.Primary}, snap.Aux...) {
+		m.Files = append(m.Files, manifest.File{Name: a.Name, Size: a.Size, ModTime: a.ModTime.UTC()})
+	}
+
+	quarantine, err := w.inspect(snap, m, validation)
+	if err != nil {
+		return err
+	}
+
+	w.inspectCluster(snap, m)
+
+	at, source := w.snapshotTime(snap, m, tsSource)
+	ts := snapshot.FormatTimestamp(at)
+	m.Snapshot, m.TimestampSource = ts, source
+
+	manifestData, err := m.Marshal()
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	extra := []fs.Member{{Name: manifest.FileName, Data: manifestData}}
+
+	// Archives already written are finished even when ctx is cancelled, so
+	// their sidecars, cluster sets and retention stay consistent.
+	done := context.WithoutCancel(ctx)
+
+	var errs []error
+	for _, group := range groupByFormat(w.pending(ctx, targets, ts, snap.Primary)) {
+		if ctx.Err() != nil {
+			break
+		}
+		admitted, refused := w.admit(ctx, group, snap)
+		results := make(map[*target]archiveResult, len(group))
+		if len(admitted) > 0 {
+			results = w.archiveGroup(ctx, snap, ts, admitted, stagingDir, quarantine, extra)
+		}
+		for t, err := range refused {
+			results[t] = archiveResult{err: err}
+		}
+
+		for _, t := range group {
+			res := results[t]
+			if res.err != nil && ctx.Err() != nil {
+				w.logg.Info("archiving to target interrupted", "target", t.cfg.Name, "cause", context.Cause(ctx))
+				continue
+			}
+			if res.err == nil && quarantine != nil {
+				w.logg.Warn("snapshot quarantined", "target", t.cfg.Name, "archive", res.archive)
+				res.err = fmt.Errorf("snapshot quarantined: %w", quarantine)
+			}
+			if res.err != nil {
+				snapshotsFailed.Inc(t.cfg.Name)
+				w.mu.Lock()
+				t.recordFailure(res.err)
+				w.mu.Unlock()
+
+				w.logg.Error("archiving to target failed", "target", t.cfg.Name, "error", res.err)
+				w.advance(done, t, journal.Failed, "")
+				if t.cfg.FailurePolicy == "fail" {
+					errs = append(errs, fmt.Errorf("target %s: %w", t.cfg.Name, res.err))
+				}
+				continue
+			}
+
+			w.writeSidecar(done, t, res, *m, signer)
+			w.advance(done, t, journal.Committed, res.archive)
+			observeArchive(t.cfg.Name, res)
+
+			w.mu.Lock()
+			t.recordSuccess(res.archive)
+			t.progress.lastSize = res.sums.Archive.Size
+			w.mu.Unlock()
+
+			w.logg.Info("snapshot archived", "target", t.cfg.Name, "archive", res.archive)
+			w.logg.Debug("destination root resolved", "target", t.cfg.Name, "root", t.root())
+
+			protected, ok := w.updateClusterSets(done, t, at, m.Cluster != nil)
+			if !ok {
+				w.logg.Warn("cluster sets unknown, skipping retention to keep them intact", "target", t.cfg.Name)
+				continue
+			}
+			if err := t.retention.Apply(done, t.fs, t.root(), res.archive, protected); err != nil {
+				w.logg.Error("worker: retention failed", "target", t.cfg.Name, "error", err)
+				continue
+			}
+			w.advance(done, t, journal.Promoted, "")
+		}
+	}
+
+	if ctx.Err() != nil {
+		errs = append(errs, context.Cause(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// inspect checks the primary RDB file and records its metadata in m. A failed
+// check either rejects the snapshot (returned as error) or, in quarantine mode,
+// is returned as the quarantine reason so the snapshot is archived aside.
+// With validation off, failures are only logged.
+func (w *Worker) inspect(snap snapshot.Snapshot, m *manifest.Manifest, mode string) (quarantine error, err error) {
+	file, ok := snap.RDB()
+	if !ok {
+		w.logg.Debug("snapshot has no rdb file, skipping validation", "mode", snap.Mode)
+		return nil, nil
+	}
+	path := filepath.Join(snap.Dir, file.Name)
+	res, meta, verr := rdb.InspectFile(path)
+	if res.Magic != "" {
+		m.SetRDB(res, meta)
+		if meta != nil && !meta.Complete {
+			w.logg.Debug("rdb metadata is partial", "path", path, "reason", meta.ParseError)
+		}
+	}
+
+	if verr == nil {
+		if !res.Verified {
+			w.logg.Warn("rdb checksum disabled on server, only structure was validated", "path", path)
+		}
+		w.logg.Debug("rdb validated", "path", path, "magic", res.Magic, "version", res.Version, "size", res.Size)
+		return nil, nil
+	}
+
+	if !errors.Is(verr, rdb.ErrInvalid) {
+		return nil, fmt.Errorf("reading snapshot for validation: %w", verr)
+	}
+
+	switch mode {
+	case "off":
+		w.logg.Warn("snapshot failed validation, archiving it anyway", "path", path, "error", verr)
+		return nil, nil
+	case "quarantine":
+		snapshotsRejected.Inc("quarantine")
+		w.logg.Error("snapshot failed validation, archiving it into quarantine", "path", path, "error", verr)
+		return verr, nil
+	}
+
+	snapshotsRejected.Inc("reject")
+	w.logg.Error("snapshot failed validation, rejecting it", "path", path, "error", verr)
+	return nil, fmt.Errorf("snapshot rejected: %w", verr)
+}
+
+// inspectCluster records the topology from the first nodes.conf aux file.
+// A file that cannot be parsed is still archived, just not described.
+func (w *Worker) inspectCluster(snap snapshot.Snapshot, m *manifest.Manifest) {
+	for _, a := range snap.Aux {
+		if !cluster.IsNodesFile(a.Name) {
+			continue
+		}
+		path := filepath.Join(snap.Dir, a.Name)
+		topo, err := cluster.ParseNodesFile(path)
+		if err != nil {
+			w.logg.Warn("parsing cluster config failed", "path", path, "error", err)
+			return
+		}
+		m.Cluster = &manifest.Cluster{File: a.Name, Topology: *topo}
+		if topo.Myself != nil {
+			w.logg.Debug("cluster topology read", "path", path, "node", topo.Myself.ID, "role", topo.Myself.Role,
+				"slots", topo.Myself.SlotCount(), "currentEpoch", topo.CurrentEpoch)
+		}
+		return
+	}
+}
+
+// snapshotTime picks the time the archive is named after, and with it the
+// retention buckets the snapshot falls into. ctime falls back to the file
+// mtime when the RDB carries no usable ctime aux field.
+func (w *Worker) snapshotTime(snap snapshot.Snapshot, m *manifest.Manifest, source string) (time.Time, string) {
+	switch source {
+	case "ctime":
+		if m.RDB != nil && !m.RDB.CTime.IsZero() {
+			return m.RDB.CTime, source
+		}
+		w.logg.Warn("rdb has no ctime aux field, naming snapshot after its mtime", "file", snap.Primary.Name)
+	case "detected":
+		if !snap.DetectedAt.IsZero() {
+			return snap.DetectedAt, source
+		}
+	}
+	return snap.Primary.ModTime, "mtime"
+}
 
+// Status returns the per-target archive status.
+func (w *Worker) Status() []TargetStatus {
 	w.mu.RLock()
-	dest := w.cfg
-	w.mu.RUnlock()
+	defer w.mu.RUnlock()
 
-	root := filepath.Join(dest.Root, dest.SubDir)
-	w.logg.Debug("destination root resolved", "root", root)
+	out := make([]TargetStatus, 0, len(w.targets))
+	for _, t := range w.targets {
+		out = append(out, t.progress.status)
+	}
+	return out
+}
 
-	if err := w.retention.Apply(ctx, w.fs, root, finalDir); err != nil {
-		w.logg.Error("worker: retention failed", "error", err)
+// Queue reports the mailbox state and the snapshots that were never archived.
+func (w *Worker) Queue() QueueStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return QueueStatus{
+		Pending:   w.mb.HasJob(),
+		Dropped:   w.mb.Dropped(),
+		Preempted: w.preempted,
+		Preempt:   w.cfg.Preempt,
 	}
+}
 
-	return nil
+// Snapshots lists the archives of the named target (the first one when empty).
+// rule restricts the listing to one rule folder.
+func (w *Worker) Snapshots(ctx context.Context, targetName, rule string) ([]catalog.Entry, error) {
+	w.mu.RLock()
+	var t *target
+	for _, c := range w.targets {
+		if targetName == "" || c.cfg.Name == targetName {
+			t = c
+			break
+		}
+	}
+	w.mu.RUnlock()
+
+	if t == nil {
+		return nil, fmt.Errorf("unknown destination target %q", targetName)
+	}
+	if rule != "" {
+		return catalog.List(ctx, t.fs, t.root(), rule)
+	}
+	return catalog.List(ctx, t.fs, t.root())
 }
 
+// UpdateConfig hot‑reloads destination settings. Targets are matched by name;
+// an unchanged backend keeps its connection, retention engine and status.
 func (w *Worker) UpdateConfig(cfg Config) {
 	w.logg.Debug("uppdating config")
+
 	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case cfg.Signing.KeyFile == "":
+		w.signer = nil
+	default:
+		signer, err := manifest.LoadSigner(cfg.Signing.KeyFile)
+		if err != nil {
+			w.logg.Error("invalid signing key, keeping the previous one", "error", err)
+			break
+		}
+		w.signer = signer
+	}
+
+	existing := make(map[string]*target, len(w.targets))
+	for _, t := range w.targets {
+		existing[t.cfg.Name] = t
+	}
+
+	var updated []*target
+	for _, tc := range cfg.TargetConfigs() {
+		old, ok := existing[tc.Name]
+		if ok && old.cfg.Backend == tc.Backend && old.cfg.S3 == tc.S3 {
+			// Key files are re-read on every reload, so rotated keys apply
+			// to the next archive.
+			sealer, err := crypt.NewSealer(tc.Encryption)
+			if err != nil {
+				w.logg.Error("invalid encryption, keeping the previous target config", "target", tc.Name, "error", err)
+				updated = append(updated, old)
+				continue
+			}
+			updated = append(updated, old.reloaded(tc, sealer))
+			continue
+		}
+
+		t, err := newTarget(tc, w.local, w.logg)
+		if err != nil {
+			w.logg.Error("invalid destination target, ignoring it", "target", tc.Name, "backend", tc.Backend, "error", err)
+			if ok {
+				updated = append(updated, old)
+			}
+			continue
+		}
+		if ok {
+			t.progress = old.progress
+			t.progress.status.Backend = tc.Backend
+		}
+		updated = append(updated, t)
+	}
+
+	w.forgetRemoved(existing, updated)
 	w.cfg = cfg
-	w.mu.Unlock()
+	w.targets = updated
 
-	w.updateRetentionRules()
+	select {
+	case w.reload <- struct{}{}:
+	default:
+	}
 }
 
-// writeSnapshot creates a tar+compressed archive for all snapshot files atomically.
-func (w *Worker) writeSnapshot(ctx context.Context, snap snapshot.Snapshot) (string, error) {
-	w.mu.RLock()
-	dest := w.cfg
-	w.mu.RUnlock()
+// forgetRemoved drops the metrics of targets that a reload removed, so their
+// gauges do not keep reporting stale values.
+func (w *Worker) forgetRemoved(existing map[string]*target, updated []*target) {
+	for _, t := range updated {
+		delete(existing, t.cfg.Name)
+	}
+	for name, t := range existing {
+		compressionRatio.Delete(name)
+		lastSuccess.Delete(name)
+		t.retention.Forget()
+	}
+}
+
+type archiveResult struct {
+	archive string
+	sums    fs.Checksums
+	took    time.Duration // writing, or staging plus copying
+	err     error
+}
 
-	root := filepath.Join(dest.Root, dest.SubDir)
-	snapDir := filepath.Join(root, dest.SnapshotSubdir)
+// writeSidecar stores m, completed with the archive checksums, next to the
+// archive and signs it when a signing key is configured. Failures are logged:
+// the archive itself is complete.
+func (w *Worker) writeSidecar(ctx context.Context, t *target, res archiveResult, m manifest.Manifest, signer *manifest.Signer) {
+	sums := res.sums
+	sums.Archive.Name = filepath.Base(res.archive)
+	m.Checksums = &sums
+
+	data, err := m.Marshal()
+	if err != nil {
+		w.logg.Error("encoding manifest sidecar failed", "target", t.cfg.Name, "error", err)
+		return
+	}
+	sidecar := manifest.SidecarPath(res.archive)
+	if err := t.fs.WriteFile(ctx, sidecar, data); err != nil {
+		w.logg.Error("writing manifest sidecar failed", "target", t.cfg.Name, "path", sidecar, "error", err)
+		return
+	}
+	if signer == nil {
+		return
+	}
+	sig, err := signer.Sign(data)
+	if err == nil {
+		err = t.fs.WriteFile(ctx, manifest.SignaturePath(res.archive), sig)
+	}
+	if err != nil {
+		w.logg.Error("signing manifest sidecar failed", "target", t.cfg.Name, "path", sidecar, "error", err)
+	}
+}
 
-	ts := snap.Primary.ModTime.UTC().Format("2006-01-02T15-04-05")
+// groupByFormat splits targets into groups sharing compression and encryption
+// settings, keeping the configured order. Each group needs the archive
+// produced only once.
+func groupByFormat(targets []*target) [][]*target {
+	var (
+		groups [][]*target
+		index  = make(map[string]int)
+	)
+	for _, t := range targets {
+		key := fmt.Sprintf("%+v|%+v", t.cfg.Compression, t.cfg.Encryption)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], t)
+	}
+	return groups
+}
 
-	// For now we fix the extension to .tar.zst; algorithm/level are hidden in fs.Config.
-	tmpArchive := filepath.Join(snapDir, ".tmp-"+ts+".tar.zst")
-	finalArchive := filepath.Join(snapDir, ts+".tar.zst")
+// archiveGroup compresses the snapshot once for a group of targets and copies
+// the result into the remaining ones. The archive is produced directly in the
+// first local target; if there is none, it is built in the staging dir.
+// Quarantined snapshots go to each target's quarantine folder instead.
+// extra members, such as the manifest, are appended to the archive.
+func (w *Worker) archiveGroup(ctx context.Context, snap snapshot.Snapshot, ts string, group []*target, stagingDir string, quarantine error, extra []fs.Member) map[*target]archiveResult {
+	results := make(map[*target]archiveResult, len(group))
+	codec, err := fs.CodecByName(group[0].cfg.Compression.Codec)
+	if err != nil {
+		for _, t := range group {
+			results[t] = archiveResult{err: err}
+		}
+		return results
+	}
+	opts := fs.ArchiveOptions{Level: group[0].cfg.Compression.Level, Codec: codec, Extra: extra}
+	if sealer := group[0].sealer; sealer != nil {
+		opts.Seal = sealer
+	}
+	name := group[0].archiveName(ts, codec)
+	if stagingDir == "" {
+		stagingDir = os.TempDir()
+	}
+
+	// Journal what is about to be written, so a crash leaves no orphans.
+	hasLocal := slices.ContainsFunc(group, (*target).isLocal)
+	for _, t := range group {
+		var staging []string
+		if !hasLocal {
+			staging = []string{tmpPath(stagingDir, name), filepath.Join(stagingDir, name)}
+		}
+		var partial []string
+		if !fs.WritesAtomically(t.fs) {
+			partial = []string{tmpPath(t.archiveDir(quarantine != nil), name)}
+		}
+		w.begin(ctx, t, partial, staging)
+	}
+
+	var (
+		src    string
+		sums   fs.Checksums  // identical for every copy of the archive
+		staged time.Duration // spent creating src, added to the copies
+	)
+	for _, t := range group {
+		if !t.isLocal() {
+			continue
+		}
+		start := time.Now()
+		final, s, err := w.writeSnapshot(ctx, t.fs, t.archiveDir(quarantine != nil), snap, name, opts)
+		results[t] = archiveResult{archive: final, sums: s, err: err, took: time.Since(start)}
+		if err == nil {
+			src, sums, staged = final, s, time.Since(start)
+			break
+		}
+	}
+
+	if len(results) == len(group) {
+		return results
+	}
+
+	if src == "" {
+		start := time.Now()
+		tmp, s, err := w.writeSnapshot(ctx, w.local, stagingDir, snap, name, opts)
+		if err != nil {
+			for _, t := range group {
+				if _, done := results[t]; !done {
+					results[t] = archiveResult{err: fmt.Errorf("staging archive: %w", err)}
+				}
+			}
+			return results
+		}
+		defer func() { _ = w.local.RemoveAll(context.WithoutCancel(ctx), tmp) }()
+		src, sums, staged = tmp, s, time.Since(start)
+	}
+
+	for _, t := range group {
+		if _, done := results[t]; done {
+			continue
+		}
+		start := time.Now()
+		final, err := w.importSnapshot(ctx, t.fs, t.archiveDir(quarantine != nil), src, name)
+		results[t] = archiveResult{archive: final, sums: sums, err: err, took: staged + time.Since(start)}
+	}
+
+	return results
+}
+
+// writeSnapshot creates a tar+compressed archive named name for all snapshot files atomically.
+// It returns the final path and the checksums computed while writing.
+func (w *Worker) writeSnapshot(ctx context.Context, dst fs.FS, snapDir string, snap snapshot.Snapshot, name string, opts fs.ArchiveOptions) (string, fs.Checksums, error) {
+	tmpArchive := writePath(dst, snapDir, name)
+	finalArchive := filepath.Join(snapDir, name)
 
 	w.logg.Debug("new destinations", "tmpArchive", tmpArchive, "finalArchive", finalArchive)
 
-	if err := w.fs.MkdirAll(snapDir); err != nil {
-		return "", fmt.Errorf("creating snapshot dir: %w", err)
+	if err := dst.MkdirAll(snapDir); err != nil {
+		return "", fs.Checksums{}, fmt.Errorf("creating snapshot dir: %w", err)
 	}
 
 	// Collect all artifact names (primary + aux) relative to snap.Dir.
@@ -112,40 +627,85 @@ func (w *Worker) writeSnapshot(ctx context.Context, snap snapshot.Snapshot) (str
 	files = append(files, snap.Primary.Name)
 	for _, a := range snap.Aux {
 		files = append(files, a.Name)
+		if a.Growing {
+			if opts.Limits == nil {
+				opts.Limits = make(map[string]int64)
+			}
+			opts.Limits[a.Name] = a.Size
+		}
 	}
 
 	// Create compressed tar archive into tmp file.
-	if err := w.fs.CreateCompressedTar(ctx, snap.Dir, files, tmpArchive); err != nil {
-		_ = w.fs.RemoveAll(tmpArchive)
-		return "", fmt.Errorf("creating compressed archive: %w", err)
+	sums, err := dst.CreateCompressedTar(ctx, snap.Dir, files, tmpArchive, opts)
+	if err != nil {
+		removeTmp(ctx, dst, tmpArchive, finalArchive)
+		return "", fs.Checksums{}, fmt.Errorf("creating compressed archive: %w", err)
 	}
 
-	// Finalize atomically: remove existing final archive if present, then rename.
-	if _, err := w.fs.Stat(finalArchive); err == nil {
-		if err := w.fs.RemoveAll(finalArchive); err != nil {
-			return "", fmt.Errorf("failed to remove existing final archive: %w", err)
-		}
+	if err := finalize(ctx, dst, tmpArchive, finalArchive); err != nil {
+		return "", fs.Checksums{}, err
+	}
+	return finalArchive, sums, nil
+}
+
+// importSnapshot copies an already built local archive into a target under name.
+func (w *Worker) importSnapshot(ctx context.Context, dst fs.FS, snapDir, src, name string) (string, error) {
+	tmpArchive := writePath(dst, snapDir, name)
+	finalArchive := filepath.Join(snapDir, name)
+
+	if err := dst.MkdirAll(snapDir); err != nil {
+		return "", fmt.Errorf("creating snapshot dir: %w", err)
 	}
 
-	if err := w.fs.Rename(ctx, tmpArchive, finalArchive); err != nil {
-		_ = w.fs.RemoveAll(tmpArchive)
-		return "", fmt.Errorf("finalizing snapshot archive: %w", err)
+	if err := dst.Import(ctx, src, tmpArchive); err != nil {
+		removeTmp(ctx, dst, tmpArchive, finalArchive)
+		return "", fmt.Errorf("copying archive: %w", err)
 	}
 
+	if err := finalize(ctx, dst, tmpArchive, finalArchive); err != nil {
+		return "", err
+	}
 	return finalArchive, nil
 }
 
-// updateRetentionRules adds to the retention rules the snapshotwatcher one
-func (w *Worker) updateRetentionRules() {
-	w.logg.Debug("entering Worker.updateRetentionRules")
-	w.mu.RLock()
-	mainRule := retention.Rule{
-		Name:  w.cfg.SnapshotSubdir,
-		Cron:  "",
-		Count: w.cfg.Retention.LastCount,
+// tmpPath is where an archive named name is written before finalize.
+func tmpPath(dir, name string) string {
+	return filepath.Join(dir, ".tmp-"+name)
+}
+
+// writePath is where an archive named name is written on dst: its final path
+// where writes are atomic, else tmpPath.
+func writePath(dst fs.FS, dir, name string) string {
+	if fs.WritesAtomically(dst) {
+		return filepath.Join(dir, name)
 	}
-	updated := append([]retention.Rule{mainRule}, w.cfg.Retention.Rules...)
-	removeUnknownFolders := w.cfg.Retention.RemoveUnknownFolders
-	w.mu.RUnlock()
-	w.retention.UpdateConfig(retention.Config{RemoveUnknownFolders: removeUnknownFolders, Rules: updated})
+	return tmpPath(dir, name)
+}
+
+// removeTmp deletes what a failed write left at tmpArchive. A failed atomic
+// write leaves nothing, and the final archive it targeted may predate it.
+func removeTmp(ctx context.Context, dst fs.FS, tmpArchive, finalArchive string) {
+	if tmpArchive != finalArchive {
+		_ = dst.RemoveAll(context.WithoutCancel(ctx), tmpArchive)
+	}
+}
+
+// finalize atomically moves tmp into place: remove existing final archive if present, then rename.
+// It has nothing to do when the archive was written in place.
+func finalize(ctx context.Context, dst fs.FS, tmpArchive, finalArchive string) error {
+	if tmpArchive == finalArchive {
+		return nil
+	}
+	if _, err := dst.Stat(ctx, finalArchive); err == nil {
+		if err := dst.RemoveAll(ctx, finalArchive); err != nil {
+			_ = dst.RemoveAll(context.WithoutCancel(ctx), tmpArchive)
+			return fmt.Errorf("failed to remove existing final archive: %w", err)
+		}
+	}
+
+	if err := dst.Rename(ctx, tmpArchive, finalArchive); err != nil {
+		_ = dst.RemoveAll(context.WithoutCancel(ctx), tmpArchive)
+		return fmt.Errorf("finalizing snapshot archive: %w", err)
+	}
+	return nil
 }